@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	agentTimeout     = time.Minute
+	agentPollTimeout = 30 * time.Second
+	agentInterval    = time.Second
+	agentStopGrace   = 10 * time.Second
+)
+
+// Files of project that are sent to agent
+var agentFiles = []string{scriptFile, "script.cmd", pipelineFile}
+
+var errAgentUnknown = errors.New("agent is not registered")
+
+// Remote agent connected to lurch
+type Agent struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	Labels   []string  `json:"labels"`
+	LastSeen time.Time `json:"lastSeen"`
+	Job      string    `json:"job,omitempty"`
+}
+
+// Job sent to agent for execution
+type AgentAssignment struct {
+	Id      string            `json:"id"`
+	Project string            `json:"project"`
+	Job     string            `json:"job"`
+	Params  map[string]string `json:"params,omitempty"`
+	Files   map[string]string `json:"files"`
+}
+
+type agentJob struct {
+	assignment *AgentAssignment
+	b          *Job
+	labels     []string
+	agent      *Agent
+	lastSeen   time.Time
+	assigned   chan bool
+	done       chan JobStatus
+}
+
+// Pool of registered agents and jobs waiting for them
+type AgentPool struct {
+	mutex     *sync.Mutex
+	agents    map[string]*Agent
+	queue     []*agentJob
+	jobs      map[string]*agentJob
+	wake      chan bool
+	stopGrace time.Duration
+}
+
+func NewAgentPool() *AgentPool {
+	return &AgentPool{mutex: &sync.Mutex{}, agents: make(map[string]*Agent), jobs: make(map[string]*agentJob), wake: make(chan bool), stopGrace: agentStopGrace}
+}
+
+func parseAgentLabels(value any) ([]string, error) {
+	if label, ok := value.(string); ok {
+		return []string{label}, nil
+	}
+	items, err := yamlList(value, "agent")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(items))
+	for i, item := range items {
+		if result[i], err = yamlString(item, "agent"); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Registers new agent with its labels
+func (p *AgentPool) Register(name string, labels []string) Agent {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	a := &Agent{Id: randomToken(16), Name: name, Labels: labels, LastSeen: time.Now()}
+	p.agents[a.Id] = a
+	log.Printf("-- agent %s registered with labels %s", a.Name, strings.Join(a.Labels, ","))
+	return *a
+}
+
+// Lists agents seen recently, the rest is forgotten
+func (p *AgentPool) List() []Agent {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	result := make([]Agent, 0)
+	for id, a := range p.agents {
+		if time.Since(a.LastSeen) > agentTimeout {
+			log.Printf("-- agent %s lost", a.Name)
+			delete(p.agents, id)
+			continue
+		}
+		result = append(result, *a)
+	}
+	slices.SortFunc(result, func(a, b Agent) int {
+		return strings.Compare(a.Name+a.Id, b.Name+b.Id)
+	})
+	return result
+}
+
+// Gets count of jobs waiting for agent
+func (p *AgentPool) Queued() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.queue)
+}
+
+// Waits for job matching labels of agent until timeout or context is done, nil is returned if there is no job
+func (p *AgentPool) Poll(ctx context.Context, id string) (*AgentAssignment, error) {
+	timer := time.NewTimer(agentPollTimeout)
+	defer timer.Stop()
+	for {
+		p.mutex.Lock()
+		a, ok := p.agents[id]
+		if !ok {
+			p.mutex.Unlock()
+			return nil, errAgentUnknown
+		}
+		a.LastSeen = time.Now()
+		for i, j := range p.queue {
+			if matchesLabels(a.Labels, j.labels) {
+				p.queue = slices.Delete(p.queue, i, i+1)
+				j.agent = a
+				j.lastSeen = time.Now()
+				a.Job = fmt.Sprintf("%s #%s", j.b.p.name, j.b.name)
+				// Output of agent has to start after this line, so lines of stages reported by agent fit
+				fmt.Fprintf(j.b.stages, "running on agent %s\n", a.Name)
+				j.b.stages.startRemote()
+				close(j.assigned)
+				p.mutex.Unlock()
+				return j.assignment, nil
+			}
+		}
+		wake := p.wake
+		p.mutex.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+}
+
+// Enqueues job for the first agent with all required labels
+func (p *AgentPool) Enqueue(b *Job, labels []string, files map[string]string) *agentJob {
+	j := &agentJob{b: b, labels: labels, assigned: make(chan bool), done: make(chan JobStatus, 1)}
+	j.assignment = &AgentAssignment{Id: randomToken(32), Project: b.p.name, Job: b.name, Params: b.params, Files: files}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.queue = append(p.queue, j)
+	p.jobs[j.assignment.Id] = j
+	close(p.wake)
+	p.wake = make(chan bool)
+	return j
+}
+
+// Gets job assigned to agent and marks both job and agent as seen
+func (p *AgentPool) Job(id string) *agentJob {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	j, ok := p.jobs[id]
+	if !ok || j.agent == nil {
+		return nil
+	}
+	j.lastSeen = time.Now()
+	j.agent.LastSeen = j.lastSeen
+	return j
+}
+
+// Finishes job and releases its agent
+func (p *AgentPool) Finish(j *agentJob, status JobStatus) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.jobs[j.assignment.Id]; !ok {
+		return
+	}
+	delete(p.jobs, j.assignment.Id)
+	if index := slices.Index(p.queue, j); index >= 0 {
+		p.queue = slices.Delete(p.queue, index, index+1)
+	}
+	if j.agent != nil {
+		j.agent.Job = ""
+	}
+	j.done <- status
+}
+
+// Checks if job was not updated by its agent for too long, agent polling for other jobs might have lost the assignment
+func (p *AgentPool) isLost(j *agentJob) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return j.agent != nil && time.Since(j.lastSeen) > agentTimeout
+}
+
+func matchesLabels(labels, required []string) bool {
+	for _, r := range required {
+		if !slices.Contains(labels, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs job on remote agent and waits until it is finished or agent is lost
+func (c *Context) runOnAgent(b *Job, labels []string) JobStatus {
+	files := make(map[string]string)
+	for _, name := range agentFiles {
+		if data, err := os.ReadFile(filepath.Join(b.p.dir, name)); err == nil {
+			files[name] = string(data)
+		}
+	}
+
+	fmt.Fprintf(b.stages, "waiting for agent with labels %s\n", strings.Join(labels, ","))
+	j := c.agents.Enqueue(b, labels, files)
+
+	select {
+	case <-j.assigned:
+	case <-b.stop:
+		c.agents.Finish(j, Stopped)
+		return Stopped
+	}
+
+	// Agent is told to stop by response to its output, job is stopped anyway, if agent does not finish it in time
+	stop := b.stop
+	var grace <-chan time.Time
+	ticker := time.NewTicker(agentInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case status := <-j.done:
+			return status
+		case <-stop:
+			stop = nil
+			grace = time.After(c.agents.stopGrace)
+		case <-grace:
+			c.agents.Finish(j, Stopped)
+		case <-ticker.C:
+			if c.agents.isLost(j) {
+				b.stages.lineBreak()
+				fmt.Fprintf(b.stages, "agent %s lost\n", j.agent.Name)
+				c.agents.Finish(j, Failed)
+			}
+		}
+	}
+}
+
+// Client of lurch server, that runs assigned jobs in its own work dir
+type agentClient struct {
+	c      *Context
+	id     string
+	name   string
+	labels []string
+	client *http.Client
+}
+
+// Connects to lurch server and runs assigned jobs until lurch is stopped
+func runAgent(c *Context) {
+	a := &agentClient{c: c, labels: append([]string{runtime.GOOS, runtime.GOARCH}, c.conf.agentLabels...), client: &http.Client{Timeout: agentPollTimeout + agentInterval*10}}
+	a.name, _ = os.Hostname()
+	NewWebSocketService(c)
+
+	for !c.IsDraining() {
+		if a.id == "" {
+			if err := a.register(); err != nil {
+				log.Print("-- could not register agent: ", err)
+				time.Sleep(agentInterval * 5)
+				continue
+			}
+			log.Printf("-- agent registered to %s with labels %s", c.conf.agentUrl, strings.Join(a.labels, ","))
+		}
+
+		as, err := a.poll()
+		if err == errAgentUnknown {
+			a.id = ""
+		} else if err != nil {
+			log.Print("-- could not poll for jobs: ", err)
+			time.Sleep(agentInterval * 5)
+		} else if as != nil {
+			a.run(as)
+		}
+	}
+}
+
+func (a *agentClient) request(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(a.c.conf.agentUrl, "/")+"/rest/agents/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.c.conf.agentToken)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, errors.New("agent token was not accepted")
+	}
+	return resp, nil
+}
+
+func (a *agentClient) register() error {
+	data, _ := json.Marshal(&Agent{Name: a.name, Labels: a.labels})
+	resp, err := a.request(http.MethodPost, "register", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result Agent
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Id == "" {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	a.id = result.Id
+	return nil
+}
+
+func (a *agentClient) poll() (*AgentAssignment, error) {
+	resp, err := a.request(http.MethodPost, "poll/"+a.id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, errAgentUnknown
+	case http.StatusOK:
+		var result AgentAssignment
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+	return nil, fmt.Errorf("unexpected response %s", resp.Status)
+}
+
+// Runs assigned job, streams its output and uploads its artifact and status afterwards
+func (a *agentClient) run(as *AgentAssignment) {
+	p := a.c.OpenProject(as.Project)
+	if p == nil || as.Job == "" || filepath.Base(as.Job) != as.Job {
+		log.Printf("-- refused job #%s of %s", as.Job, as.Project)
+		a.finish(as, nil, Failed)
+		return
+	}
+	os.MkdirAll(p.dir, 0755)
+	for _, name := range agentFiles {
+		os.Remove(filepath.Join(p.dir, name))
+		if content, ok := as.Files[name]; ok {
+			os.WriteFile(filepath.Join(p.dir, name), []byte(content), 0755)
+		}
+	}
+
+	b := &Job{name: as.Job, dir: filepath.Join(p.dir, as.Job), p: p}
+	os.RemoveAll(b.dir)
+	if err := b.init(); err != nil {
+		log.Printf("-- could not create job #%s of %s", b.name, p.name)
+		a.finish(as, nil, Failed)
+		return
+	}
+	defer os.RemoveAll(b.dir)
+	b.SetParams(as.Params)
+
+	a.c.mutex.Lock()
+	a.c.jobs = append(a.c.jobs, b)
+	a.c.running.Add(1)
+	a.c.mutex.Unlock()
+	defer a.c.running.Done()
+
+	log.Printf(">> started job #%s for %s", b.name, p.name)
+	done := make(chan JobStatus, 1)
+	go func() {
+		done <- a.c.execute(b)
+	}()
+
+	var offset int64
+	var stages []byte
+	ticker := time.NewTicker(agentInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case status := <-done:
+			a.streamOutput(as, b, &offset)
+			a.reportStages(as, b, &stages)
+			a.uploadArtifacts(as, b)
+			a.finish(as, b, status)
+			log.Printf("<< finished job #%s for %s", b.name, p.name)
+			return
+		case <-ticker.C:
+			if stopped := a.streamOutput(as, b, &offset); stopped {
+				a.c.Interrupt(b)
+			}
+			a.reportStages(as, b, &stages)
+		}
+	}
+}
+
+// Sends new output of job to server, returns true if job was stopped or is not known on server
+func (a *agentClient) streamOutput(as *AgentAssignment, b *Job, offset *int64) bool {
+	var data []byte
+	if f, err := os.Open(b.OutputPath()); err == nil {
+		f.Seek(*offset, io.SeekStart)
+		data, _ = io.ReadAll(f)
+		f.Close()
+	}
+
+	resp, err := a.request(http.MethodPost, "output/"+as.Id, bytes.NewReader(data))
+	if err != nil {
+		log.Print("-- could not send output: ", err)
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusGone {
+		*offset += int64(len(data))
+	}
+	return resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound
+}
+
+// Sends stages of job to server, if they changed since they were sent last time
+func (a *agentClient) reportStages(as *AgentAssignment, b *Job, sent *[]byte) {
+	data, err := os.ReadFile(b.StagesPath())
+	if err != nil || bytes.Equal(data, *sent) {
+		return
+	}
+	resp, err := a.request(http.MethodPost, "stages/"+as.Id, bytes.NewReader(data))
+	if err != nil {
+		log.Print("-- could not send stages: ", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		*sent = data
+	}
+}
+
+// Uploads artifact archive and named artifacts of job
+func (a *agentClient) uploadArtifacts(as *AgentAssignment, b *Job) {
+	a.uploadArtifact(as, b.ArtifactPath(), "")
+	for _, name := range b.Artifacts() {
+		a.uploadArtifact(as, b.NamedArtifactPath(name), name)
+	}
+}
+
+func (a *agentClient) uploadArtifact(as *AgentAssignment, path, name string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if resp, err := a.request(http.MethodPut, "artifact/"+as.Id+"?name="+url.QueryEscape(name), f); err != nil {
+		log.Print("-- could not upload artifact: ", err)
+	} else {
+		resp.Body.Close()
+	}
+}
+
+func (a *agentClient) finish(as *AgentAssignment, b *Job, status JobStatus) {
+	result := &DomainJob{Status: status}
+	if b != nil {
+		result.Meta = b.Meta()
+	}
+	data, _ := json.Marshal(result)
+	if resp, err := a.request(http.MethodPost, "finish/"+as.Id, bytes.NewReader(data)); err != nil {
+		log.Print("-- could not finish job: ", err)
+	} else {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunOnAgent(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", filepath.Join(tmpdir, "server")}))
+	NewWebSocketService(c)
+	os.MkdirAll(c.conf.path, 0755)
+	os.WriteFile(c.TokensPath(), []byte("agents=secret\n"), 0600)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/", (&RestService{c: c}).HandleFunc)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	defer srv.CloseClientConnections()
+
+	for i, labels := range []string{"go", "go,docker", "rust"} {
+		agent := NewContext(LoadConfig([]string{"-t", filepath.Join(tmpdir, "agent"+string(rune('0'+i))), "-ag", srv.URL, "-at", "secret", "-al", labels}))
+		go runAgent(agent)
+		defer agent.Drain(0)
+	}
+
+	p := c.OpenProject("remote")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.PipelinePath(), []byte("agent: [go]\nmatrix:\n  target: [a, b, c]\nsteps:\n  - name: build\n    run: echo \"built $TARGET\" > $TARGET.txt; cat $TARGET.txt\n  - name: check\n    run: exit 1\n    continue-on-error: true\n"), 0644)
+
+	c.StartJob(p, nil, nil, nil)
+	for i := 0; i < 100 && c.isProjectBeingBuilt(p); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	j := c.OpenJob(p, "1")
+	if s := j.Status(); s != Finished {
+		output, _ := j.ReadOutput()
+		t.Fatalf("TestRunOnAgent: job has status %s instead of finished:\n%s", s.String(), output)
+	}
+	for _, child := range j.Children() {
+		output, _ := child.ReadOutput()
+		child.LoadParams()
+		target := child.params["TARGET"]
+		if child.Status() != Finished || !strings.Contains(output, "running on agent") || target == "" || !strings.Contains(output, "built "+target+"\n") {
+			t.Fatalf("TestRunOnAgent: unexpected result of job #%s:\n%s", child.name, output)
+		}
+		stages := child.Stages()
+		if len(stages) != 2 || stages[0].Name != "build" || stages[0].Status != Finished || stages[1].Name != "check" || stages[1].Status != Failed {
+			t.Fatalf("TestRunOnAgent: unexpected stages of job #%s %v", child.name, stages)
+		}
+		if lines := strings.Split(output, "\n"); len(lines) <= stages[1].Line || lines[stages[1].Line] != "::stage check::" {
+			t.Fatalf("TestRunOnAgent: stage of job #%s does not match its output line %d:\n%s", child.name, stages[1].Line, output)
+		}
+		if child.ArtifactSize() <= 0 {
+			t.Fatalf("TestRunOnAgent: missing artifact of job #%s", child.name)
+		}
+	}
+
+	p2 := c.OpenProject("remote-stop")
+	if err = os.MkdirAll(p2.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p2.PipelinePath(), []byte("agent: rust\nsteps:\n  - sleep 30\n"), 0644)
+
+	c.StartJob(p2, nil, nil, nil)
+	time.Sleep(time.Second)
+	c.Interrupt(c.OpenJob(p2, "1"))
+	for i := 0; i < 100 && c.isProjectBeingBuilt(p2); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := c.OpenJob(p2, "1").Status(); s != Stopped {
+		t.Fatalf("TestRunOnAgent: interrupted job has status %s instead of stopped", s.String())
+	}
+
+	agents := c.agents.List()
+	if len(agents) != 3 {
+		t.Fatalf("TestRunOnAgent: 3 agents were expected, but found %d", len(agents))
+	}
+
+	if resp, err := http.Get(srv.URL + "/rest/agents"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("TestRunOnAgent: agents listed without token")
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/rest/agents/register", strings.NewReader("{\"name\": \"intruder\"}"))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("TestRunOnAgent: agent registered without token")
+	}
+}
+
+func TestStopJobWithLostAssignment(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+	c.agents.stopGrace = 100 * time.Millisecond
+
+	p := c.OpenProject("remote")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.PipelinePath(), []byte("agent: go\nsteps:\n  - sleep 30\n"), 0644)
+	a := c.agents.Register("agent", []string{"go"})
+	c.StartJob(p, nil, nil, nil)
+
+	// Assignment is taken from queue, but it never reaches the agent, that keeps polling
+	var as *AgentAssignment
+	for i := 0; as == nil && i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		as, _ = c.agents.Poll(ctx, a.Id)
+		cancel()
+	}
+	if as == nil {
+		t.Fatal("TestStopJobWithLostAssignment: job should be assigned")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	c.agents.Poll(ctx, a.Id)
+	cancel()
+
+	lost := &agentJob{agent: &Agent{LastSeen: time.Now()}, lastSeen: time.Now().Add(-2 * agentTimeout)}
+	if !c.agents.isLost(lost) {
+		t.Fatal("TestStopJobWithLostAssignment: job should be lost, even if its agent polls")
+	}
+
+	c.Interrupt(c.OpenJob(p, "1"))
+	for i := 0; i < 20 && c.isProjectBeingBuilt(p); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := c.OpenJob(p, "1").Status(); s != Stopped {
+		t.Fatalf("TestStopJobWithLostAssignment: interrupted job has status %s instead of stopped", s.String())
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Prefix of versioned REST API
+const apiPrefix = "/api/v1"
+
+// Makes handler of versioned REST API, each resource responds with DomainStatus on error
+func (s RestService) ApiHandler() http.Handler {
+	mux := http.NewServeMux()
+	routed := make(map[string]bool)
+	route := func(method, pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(method+" "+apiPrefix+pattern, handler)
+		if !routed[pattern] {
+			routed[pattern] = true
+			mux.HandleFunc(apiPrefix+pattern, func(w http.ResponseWriter, r *http.Request) {
+				s.message(w, "", http.StatusMethodNotAllowed)
+			})
+		}
+	}
+
+	route(http.MethodGet, "/openapi.json", s.openApi)
+
+	route(http.MethodGet, "/groups", s.listGroups)
+	route(http.MethodGet, "/projects", s.listProjects)
+	route(http.MethodPost, "/projects", s.authorized(s.createProject))
+	route(http.MethodGet, "/projects/{project}", func(w http.ResponseWriter, r *http.Request) {
+		s.listProject(r.PathValue("project"), w, r)
+	})
+	route(http.MethodDelete, "/projects/{project}", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		s.deleteProject(r.PathValue("project"), w, r)
+	}))
+	route(http.MethodPost, "/projects/{project}/rename", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		s.moveProject(r.PathValue("project"), "rename", w, r)
+	}))
+	route(http.MethodPost, "/projects/{project}/copy", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		s.moveProject(r.PathValue("project"), "copy", w, r)
+	}))
+	route(http.MethodPost, "/projects/{project}/disable", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		s.toggleProject(r.PathValue("project"), false, w, r)
+	}))
+	route(http.MethodPost, "/projects/{project}/enable", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		s.toggleProject(r.PathValue("project"), true, w, r)
+	}))
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		route(method, "/projects/{project}/script", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+			s.projectScript(r.PathValue("project"), w, r)
+		}))
+		route(method, "/projects/{project}/settings", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+			s.projectSettings(r.PathValue("project"), w, r)
+		}))
+	}
+	route(http.MethodGet, "/projects/{project}/stats", func(w http.ResponseWriter, r *http.Request) {
+		s.projectStats(r.PathValue("project"), w, r)
+	})
+	route(http.MethodPost, "/projects/{project}/jobs", func(w http.ResponseWriter, r *http.Request) {
+		s.startJob(r.PathValue("project"), w, r)
+	})
+	route(http.MethodGet, "/projects/{project}/jobs/{job}", func(w http.ResponseWriter, r *http.Request) {
+		s.jobDetail(r.PathValue("project"), r.PathValue("job"), w, r)
+	})
+	route(http.MethodPost, "/projects/{project}/jobs/{job}/rerun", func(w http.ResponseWriter, r *http.Request) {
+		s.rerunJob(r.PathValue("project"), r.PathValue("job"), w, r)
+	})
+	route(http.MethodPost, "/projects/{project}/jobs/{job}/interrupt", func(w http.ResponseWriter, r *http.Request) {
+		s.interruptJob(r.PathValue("project"), r.PathValue("job"), w, r)
+	})
+	route(http.MethodPatch, "/projects/{project}/jobs/{job}/meta", func(w http.ResponseWriter, r *http.Request) {
+		s.updateJobMeta(r.PathValue("project"), r.PathValue("job"), w, r)
+	})
+	route(http.MethodGet, "/projects/{project}/jobs/{job}/artifact", func(w http.ResponseWriter, r *http.Request) {
+		s.downloadArtifact(r.PathValue("project"), r.PathValue("job"), "", w, r)
+	})
+	route(http.MethodGet, "/projects/{project}/jobs/{job}/artifacts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		s.downloadArtifact(r.PathValue("project"), r.PathValue("job"), r.PathValue("name"), w, r)
+	})
+
+	route(http.MethodGet, "/agents", s.listAgents)
+	route(http.MethodPost, "/agents", s.registerAgent)
+	route(http.MethodPost, "/agents/{id}/poll", func(w http.ResponseWriter, r *http.Request) {
+		s.pollAgent(r.PathValue("id"), w, r)
+	})
+	route(http.MethodPost, "/assignments/{id}/output", func(w http.ResponseWriter, r *http.Request) {
+		s.updateAgentJob("output", r.PathValue("id"), w, r)
+	})
+	route(http.MethodPost, "/assignments/{id}/stages", func(w http.ResponseWriter, r *http.Request) {
+		s.updateAgentJob("stages", r.PathValue("id"), w, r)
+	})
+	route(http.MethodPut, "/assignments/{id}/artifact", func(w http.ResponseWriter, r *http.Request) {
+		s.updateAgentJob("artifact", r.PathValue("id"), w, r)
+	})
+	route(http.MethodPost, "/assignments/{id}/finish", func(w http.ResponseWriter, r *http.Request) {
+		s.updateAgentJob("finish", r.PathValue("id"), w, r)
+	})
+
+	route(http.MethodGet, "/events", s.streamEvents)
+
+	route(http.MethodPost, "/admin/drain", s.drain)
+
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		s.message(w, "", http.StatusNotFound)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Wraps handler, that requires API token
+func (s RestService) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.c.Authorize(r) == "" {
+			s.message(w, "", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// Serves OpenAPI description of versioned REST API
+func (s RestService) openApi(w http.ResponseWriter, r *http.Request) {
+	data, err := www.ReadFile("www/openapi.json")
+	if err != nil {
+		s.message(w, "", http.StatusNotFound)
+		return
+	}
+	w.Write(data)
+}
+
+// Downloads archive of workspace or named artifact of job
+func (s RestService) downloadArtifact(projectName, jobNumber, name string, w http.ResponseWriter, r *http.Request) {
+	b := s.openJob(projectName, jobNumber)
+	if b == nil || !serveArtifact(w, b, name) {
+		s.message(w, "artifact not found", http.StatusNotFound)
+	}
+}
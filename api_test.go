@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApi(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+	s := &RestService{c: c}
+	api := s.ApiHandler()
+
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(p.dir, "script.sh"), []byte("#!/bin/sh\n\nsleep 60"), 0755)
+
+	call := func(method, url, body string) (*httptest.ResponseRecorder, *DomainStatus) {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		var status DomainStatus
+		json.Unmarshal(w.Body.Bytes(), &status)
+		return w, &status
+	}
+
+	for _, tc := range []struct {
+		method, url string
+		code        int
+	}{
+		{http.MethodGet, "/api/v1/unknown", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/projects/unknown", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/projects/unknown/stats", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/projects/unknown/jobs", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/projects/project/jobs/1", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/projects/project/jobs/x", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/projects/project/jobs/1/interrupt", http.StatusNotFound},
+		{http.MethodPut, "/api/v1/projects/project", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/projects/project/jobs", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/projects?status=none", http.StatusBadRequest},
+	} {
+		w, status := call(tc.method, tc.url, "")
+		if w.Code != tc.code || status.Code != tc.code || status.Message == "" || w.Header().Get("content-type") != "application/json" {
+			t.Fatalf("TestApi: unexpected response %d '%s' to %s %s", w.Code, w.Body.String(), tc.method, tc.url)
+		}
+	}
+
+	if w, _ := call(http.MethodGet, "/api/v1/openapi.json", ""); w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) || !strings.Contains(w.Body.String(), "\"openapi\"") {
+		t.Fatalf("TestApi: unexpected OpenAPI description %d", w.Code)
+	}
+
+	if _, status := call(http.MethodPost, "/api/v1/projects/project/jobs", "{"); status.Code != http.StatusBadRequest {
+		t.Fatalf("TestApi: invalid body should not be accepted, got %d", status.Code)
+	}
+
+	if _, status := call(http.MethodPost, "/api/v1/projects/project/jobs", `{"meta":{"labels":{"../key":"value"}}}`); status.Code != http.StatusBadRequest {
+		t.Fatalf("TestApi: invalid metadata should not be accepted, got %d", status.Code)
+	}
+	if _, err := os.Stat(filepath.Join(p.dir, "1")); err == nil {
+		t.Fatal("TestApi: job should not be started with invalid metadata")
+	}
+
+	w, status := call(http.MethodPost, "/api/v1/projects/project/jobs", `{"meta":{"version":"1.0"}}`)
+	if w.Code != http.StatusCreated || status.Job != "1" || w.Header().Get("location") != "/api/v1/projects/project/jobs/1" {
+		t.Fatalf("TestApi: unexpected response %d '%s' to started job", w.Code, w.Body.String())
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if _, status := call(http.MethodPost, "/api/v1/projects/project/jobs", ""); status.Code != http.StatusConflict {
+		t.Fatalf("TestApi: job of project being built should conflict, got %d", status.Code)
+	}
+
+	w, _ = call(http.MethodGet, "/api/v1/projects/project/jobs/1", "")
+	var job DomainJob
+	if err := json.Unmarshal(w.Body.Bytes(), &job); w.Code != http.StatusOK || err != nil || job.Status != InProgress || job.Meta == nil || job.Meta.Version != "1.0" {
+		t.Fatalf("TestApi: unexpected job %d '%s'", w.Code, w.Body.String())
+	}
+
+	if _, status := call(http.MethodPatch, "/api/v1/projects/project/jobs/1/meta", `{"labels":{"env":"test"}}`); status.Code != 0 {
+		t.Fatalf("TestApi: metadata should be updated, got %d", status.Code)
+	}
+	if _, status := call(http.MethodPost, "/api/v1/projects/project/jobs/1/interrupt", ""); status.Code != http.StatusOK {
+		t.Fatalf("TestApi: job should be interrupted, got %d", status.Code)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	w, _ = call(http.MethodGet, "/api/v1/projects/project?label=env=test", "")
+	var project DomainProject
+	if err := json.Unmarshal(w.Body.Bytes(), &project); err != nil || len(project.Jobs) != 1 || project.Jobs[0].Status != Stopped {
+		t.Fatalf("TestApi: unexpected project '%s'", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.HandleFunc(w, httptest.NewRequest(http.MethodPost, "/rest/jobs/project/start", nil))
+	if json.Unmarshal(w.Body.Bytes(), status); w.Code != http.StatusOK || status.Job != "2" || w.Header().Get("location") != "" {
+		t.Fatalf("TestApi: old route should still start job, got %d '%s'", w.Code, w.Body.String())
+	}
+	time.Sleep(500 * time.Millisecond)
+	c.Interrupt(c.OpenJob(p, "2"))
+	time.Sleep(500 * time.Millisecond)
+}
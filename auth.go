@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Path to file with API tokens in format name=token
+func (c *Context) TokensPath() string {
+	return filepath.Join(c.conf.path, ".tokens")
+}
+
+// Gets name of token used in authorization header of request, if token is not known empty string is returned
+func (c *Context) Authorize(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return ""
+	}
+	for name, t := range loadParams(c.TokensPath()) {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return name
+		}
+	}
+	return ""
+}
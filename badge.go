@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Text and color of badge for each status of job
+var badgeStyles = map[JobStatus][2]string{
+	Unknown:    {"unknown", "#9e9e9e"},
+	Finished:   {"passing", "#4caf50"},
+	Stopped:    {"stopped", "#ffc107"},
+	Failed:     {"failing", "#f44336"},
+	InProgress: {"running", "#2196f3"},
+}
+
+const badgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">` +
+	`<title>%[3]s: %[4]s</title>` +
+	`<rect width="%[2]d" height="20" fill="#555"/>` +
+	`<rect x="%[2]d" width="%[6]d" height="20" fill="%[5]s"/>` +
+	`<g fill="#fff" text-anchor="middle" font-family="Verdana,DejaVu Sans,sans-serif" font-size="11">` +
+	`<text x="%[7]d" y="14">%[3]s</text>` +
+	`<text x="%[8]d" y="14">%[4]s</text>` +
+	`</g></svg>`
+
+// Renders SVG badge with title and text of status
+func renderBadge(title string, status JobStatus) string {
+	style := badgeStyles[status]
+	titleWidth := badgeTextWidth(title)
+	textWidth := badgeTextWidth(style[0])
+	return fmt.Sprintf(badgeTemplate, titleWidth+textWidth, titleWidth, html.EscapeString(title), style[0], style[1], textWidth, titleWidth/2, titleWidth+textWidth/2)
+}
+
+// Estimates width of text in badge
+func badgeTextWidth(text string) int {
+	return len([]rune(text))*7 + 10
+}
+
+// Serves badge with status of the latest job of project, job could be chosen by number or by filter of history
+func (s *WebService) serveBadge(w http.ResponseWriter, r *http.Request) {
+	title := r.URL.Query().Get("title")
+	if title == "" {
+		title = "build"
+	}
+
+	status, code := s.badgeStatus(r)
+	svg := renderBadge(title, status)
+
+	hash := fnv.New64a()
+	hash.Write([]byte(svg))
+	etag := fmt.Sprintf("\"%x\"", hash.Sum64())
+
+	w.Header().Set("content-type", "image/svg+xml")
+	w.Header().Set("cache-control", "no-cache, max-age=0")
+	w.Header().Set("etag", etag)
+	if code == http.StatusOK && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write([]byte(svg))
+}
+
+// Gets status of job shown in badge, unknown status is returned with HTTP code if project or job does not exist
+func (s *WebService) badgeStatus(r *http.Request) (JobStatus, int) {
+	name, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/badge/"), ".svg")
+	if !found || name == "" {
+		return Unknown, http.StatusNotFound
+	}
+	p := s.c.OpenProject(name)
+	if p == nil {
+		return Unknown, http.StatusNotFound
+	}
+	if !p.Exists() {
+		return Unknown, http.StatusNotFound
+	}
+
+	query := r.URL.Query()
+	var b *Job
+	if job := query.Get("job"); job != "" {
+		if !isNumber(job) {
+			return Unknown, http.StatusNotFound
+		}
+		b = s.c.OpenJob(p, job)
+		if _, err := os.Stat(b.dir); err != nil {
+			return Unknown, http.StatusNotFound
+		}
+	} else {
+		query.Del("title")
+		query.Set("limit", "1")
+		filter, err := parseJobFilter(query)
+		if err != nil {
+			return Unknown, http.StatusBadRequest
+		}
+		jobs, err := s.c.ListJobs(p)
+		if err != nil {
+			return Unknown, http.StatusNotFound
+		}
+		if jobs, _ = filter.apply(jobs, s.jobStatus); len(jobs) == 0 {
+			return Unknown, http.StatusOK
+		}
+		b = jobs[0]
+	}
+	return s.jobStatus(b), http.StatusOK
+}
+
+// Gets status of job, running job is always in progress
+func (s *WebService) jobStatus(b *Job) JobStatus {
+	if s.c.IsBeingBuilt(b) {
+		return InProgress
+	}
+	return b.Status()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBadge(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	s := NewWebService(c)
+
+	for _, name := range []string{"project", ".hidden"} {
+		if err = os.MkdirAll(filepath.Join(tmpdir, name), 0755); err != nil {
+			panic(err)
+		}
+	}
+	p := c.OpenProject("project")
+	for _, branch := range []string{"main", "dev"} {
+		b, _ := p.NewJob()
+		b.SetParams(map[string]string{"BRANCH": branch})
+		b.SaveParams()
+		if branch == "main" {
+			b.SetStatus(Finished)
+		} else {
+			b.SetStatus(Failed)
+		}
+	}
+
+	badge := func(url, etag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		s.HandleFunc(w, r)
+		return w
+	}
+
+	for url, expected := range map[string]string{
+		"/badge/project.svg":                   "failing",
+		"/badge/project.svg?job=1":             "passing",
+		"/badge/project.svg?param=BRANCH=main": "passing",
+		"/badge/project.svg?param=BRANCH=none": "unknown",
+	} {
+		w := badge(url, "")
+		if w.Code != http.StatusOK || w.Header().Get("content-type") != "image/svg+xml" || !strings.Contains(w.Body.String(), ">"+expected+"<") {
+			t.Fatalf("TestBadge: unexpected badge %d for %s:\n%s", w.Code, url, w.Body.String())
+		}
+	}
+
+	w := badge("/badge/project.svg?title=<tests>", "")
+	if !strings.Contains(w.Body.String(), "&lt;tests&gt;") {
+		t.Fatalf("TestBadge: title should be escaped:\n%s", w.Body.String())
+	}
+	if cached := badge("/badge/project.svg?title=<tests>", w.Header().Get("etag")); cached.Code != http.StatusNotModified || cached.Body.Len() != 0 {
+		t.Fatalf("TestBadge: unexpected code %d for cached badge", cached.Code)
+	}
+
+	for _, url := range []string{"/badge/.hidden.svg", "/badge/unknown.svg", "/badge/project.svg?job=3", "/badge/project.svg?job=..", "/badge/project"} {
+		if w := badge(url, ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), ">unknown<") {
+			t.Fatalf("TestBadge: unexpected code %d for %s", w.Code, url)
+		}
+	}
+}
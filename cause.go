@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Triggers of job
+const (
+	causeUI     = "ui"
+	causeRest   = "rest"
+	causeCli    = "cli"
+	causeScript = "script"
+)
+
+// Cause of job, that records what triggered it and who initiated it
+type JobCause struct {
+	Trigger string `json:"trigger"`
+	User    string `json:"user,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+	Project string `json:"project,omitempty"`
+	Job     string `json:"job,omitempty"`
+	RerunOf string `json:"rerunOf,omitempty"`
+}
+
+// Makes cause of job started by HTTP request, only UI and CLI could be claimed by client, REST is used otherwise
+func (c *Context) requestCause(r *http.Request, claimed *JobCause) *JobCause {
+	result := &JobCause{Trigger: causeRest, User: c.Authorize(r), Remote: remoteAddr(r)}
+	if claimed != nil && (claimed.Trigger == causeUI || claimed.Trigger == causeCli) {
+		result.Trigger = claimed.Trigger
+	}
+	return result
+}
+
+// Gets address of client, forwarded headers are ignored, because they could be set by anyone
+func remoteAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Path to cause of job
+func (b *Job) CausePath() string {
+	return filepath.Join(b.dir, "cause")
+}
+
+// Loads cause of job, if not found nil is returned
+func (b *Job) Cause() *JobCause {
+	data, err := os.ReadFile(b.CausePath())
+	if err != nil {
+		return nil
+	}
+	var result JobCause
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return &result
+}
+
+// Saves cause of job
+func (b *Job) SaveCause(cause *JobCause) error {
+	if cause == nil {
+		return nil
+	}
+	data, err := json.Marshal(cause)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.CausePath(), data, 0644)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRequestCause(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	os.WriteFile(c.TokensPath(), []byte("deployer=secret\n"), 0600)
+
+	r := httptest.NewRequest("POST", "/rest/jobs/project/start", nil)
+	r.RemoteAddr = "10.0.0.1:34567"
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-Forwarded-For", "192.168.0.1")
+
+	if cause := c.requestCause(r, &JobCause{Trigger: causeUI}); cause.Trigger != causeUI || cause.User != "deployer" || cause.Remote != "10.0.0.1" {
+		t.Fatalf("TestRequestCause: unexpected cause %v", cause)
+	}
+	if cause := c.requestCause(r, &JobCause{Trigger: causeScript, Project: "other"}); cause.Trigger != causeRest || cause.Project != "" {
+		t.Fatalf("TestRequestCause: claimed script trigger should be ignored %v", cause)
+	}
+
+	c.conf.appUrl = "https://lurch.tst"
+	if cause := c.requestCause(r, nil); cause.Trigger != causeRest || cause.Remote != "10.0.0.1" {
+		t.Fatalf("TestRequestCause: forwarded address should be ignored %v", cause)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envServer = "LURCH_SERVER"
+	envToken  = "LURCH_TOKEN"
+)
+
+// Command of CLI client calling REST API of lurch server
+type cliCommand struct {
+	name     string
+	args     []string
+	server   string
+	token    string
+	json     bool
+	follow   bool
+	output   string
+	timeout  time.Duration
+	exitCode int
+	params   map[string]string
+	filter   url.Values
+	out      io.Writer
+	client   *http.Client
+}
+
+var cliCommands = map[string]func(*cliCommand) error{
+	"projects":  (*cliCommand).projects,
+	"jobs":      (*cliCommand).jobs,
+	"start":     (*cliCommand).start,
+	"rerun":     (*cliCommand).rerun,
+	"log":       (*cliCommand).log,
+	"interrupt": (*cliCommand).interrupt,
+	"download":  (*cliCommand).download,
+}
+
+// Parses command of CLI client, if the first argument is not a command nil is returned
+func parseCliCommand(args []string) *cliCommand {
+	if len(args) == 0 || cliCommands[args[0]] == nil {
+		return nil
+	}
+	cmd := &cliCommand{name: args[0], server: os.Getenv(envServer), token: os.Getenv(envToken), params: make(map[string]string), filter: make(url.Values), out: os.Stdout, client: &http.Client{}}
+	if cmd.server == "" {
+		cmd.server = "http://localhost:5000"
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg, value, hasValue := args[i], "", false
+		if strings.HasPrefix(arg, "-") {
+			arg, value, hasValue = strings.Cut(arg, delimiter)
+		}
+		nextArg := func() string {
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			return value
+		}
+		switch arg {
+		case "-s", "--server":
+			cmd.server = nextArg()
+		case "-k", "--token":
+			cmd.token = nextArg()
+		case "-j", "--json":
+			cmd.json = true
+		case "-f", "--follow":
+			cmd.follow = true
+		case "-wt", "--wait-timeout":
+			if seconds, err := strconv.Atoi(nextArg()); err == nil && seconds >= 0 {
+				cmd.timeout = time.Duration(seconds) * time.Second
+			}
+		case "-o", "--output":
+			cmd.output = nextArg()
+		case "-P", "--param":
+			if k, v, found := strings.Cut(nextArg(), delimiter); found {
+				cmd.params[k] = v
+			}
+		case "-F", "--filter":
+			if k, v, found := strings.Cut(nextArg(), delimiter); found {
+				cmd.filter.Add(k, v)
+			}
+		default:
+			cmd.args = append(cmd.args, args[i])
+		}
+	}
+	cmd.server = strings.TrimSuffix(cmd.server, "/")
+	return cmd
+}
+
+// Runs command and returns exit code, in follow mode it reflects status of job
+func (cmd *cliCommand) run() int {
+	if err := cliCommands[cmd.name](cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "lurch %s: %s\n", cmd.name, err)
+		return exitCodeFail
+	}
+	return cmd.exitCode
+}
+
+// Gets positional argument, that is required
+func (cmd *cliCommand) arg(i int, name string) (string, error) {
+	if len(cmd.args) <= i || cmd.args[i] == "" {
+		return "", fmt.Errorf("missing %s", name)
+	}
+	return cmd.args[i], nil
+}
+
+// Calls REST API and decodes response into result, if result is nil response body is returned
+func (cmd *cliCommand) call(method, path string, body any, result any) (io.ReadCloser, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, cmd.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.token != "" {
+		req.Header.Set("Authorization", "Bearer "+cmd.token)
+	}
+	resp, err := cmd.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var status DomainStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil || status.Message == "" {
+			return nil, errors.New(resp.Status)
+		}
+		return nil, errors.New(status.Message)
+	}
+	if result == nil {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+	return nil, json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Prints value as JSON
+func (cmd *cliCommand) printJson(value any) error {
+	e := json.NewEncoder(cmd.out)
+	e.SetIndent("", "  ")
+	return e.Encode(value)
+}
+
+// Lists projects with their last job
+func (cmd *cliCommand) projects() error {
+	var projects []DomainProject
+	if _, err := cmd.call(http.MethodGet, "/rest/projects", nil, &projects); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJson(projects)
+	}
+	for _, p := range projects {
+		if len(p.Jobs) == 0 {
+			fmt.Fprintf(cmd.out, "%-30s -\n", p.Name)
+		} else {
+			fmt.Fprintf(cmd.out, "%-30s #%-6s %-10s %s\n", p.Name, p.Jobs[0].Name, p.Jobs[0].Status, formatCliDate(p.Jobs[0].StartDate))
+		}
+	}
+	return nil
+}
+
+// Lists history of jobs of project matching filter
+func (cmd *cliCommand) jobs() error {
+	project, err := cmd.arg(0, "project")
+	if err != nil {
+		return err
+	}
+	path := "/rest/projects/" + url.PathEscape(project)
+	if len(cmd.filter) > 0 {
+		path += "?" + cmd.filter.Encode()
+	}
+	var p DomainProject
+	if _, err := cmd.call(http.MethodGet, path, nil, &p); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJson(p.Jobs)
+	}
+	for _, b := range p.Jobs {
+		fmt.Fprintf(cmd.out, "#%-6s %-10s %s  %s\n", b.Name, b.Status, formatCliDate(b.StartDate), formatCliDate(b.EndDate))
+	}
+	return nil
+}
+
+// Starts new job of project with params
+func (cmd *cliCommand) start() error {
+	project, err := cmd.arg(0, "project")
+	if err != nil {
+		return err
+	}
+	var status DomainStatus
+	if _, err := cmd.call(http.MethodPost, "/rest/jobs/"+url.PathEscape(project)+"/start", &DomainJob{Params: cmd.params, Cause: &JobCause{Trigger: causeCli}}, &status); err != nil {
+		return err
+	}
+	return cmd.started(project, &status)
+}
+
+// Starts new job with params of existing job, the last job is used if job is not defined
+func (cmd *cliCommand) rerun() error {
+	project, err := cmd.arg(0, "project")
+	if err != nil {
+		return err
+	}
+	job, err := cmd.jobName(project)
+	if err != nil {
+		return err
+	}
+	var status DomainStatus
+	if _, err := cmd.call(http.MethodPost, "/rest/jobs/"+url.PathEscape(project)+"/rerun/"+url.PathEscape(job), &DomainJob{Params: cmd.params, Cause: &JobCause{Trigger: causeCli}}, &status); err != nil {
+		return err
+	}
+	return cmd.started(project, &status)
+}
+
+// Prints started job or follows its output
+func (cmd *cliCommand) started(project string, status *DomainStatus) error {
+	if cmd.follow {
+		_, err := cmd.tail(project, status.Job)
+		return err
+	}
+	if cmd.json {
+		return cmd.printJson(status)
+	}
+	fmt.Fprintf(cmd.out, "job #%s of %s started\n", status.Job, project)
+	return nil
+}
+
+// Prints output of job, the last job is used if job is not defined
+func (cmd *cliCommand) log() error {
+	project, err := cmd.arg(0, "project")
+	if err != nil {
+		return err
+	}
+	job, err := cmd.jobName(project)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.tail(project, job)
+	return err
+}
+
+// Prints output of job and in follow mode waits for its end or timeout, the last state of job is returned
+func (cmd *cliCommand) tail(project, job string) (*DomainJob, error) {
+	path := "/rest/jobs/" + url.PathEscape(project) + "/" + url.PathEscape(job)
+	printed := 0
+	var deadline time.Time
+	if cmd.timeout > 0 {
+		deadline = time.Now().Add(cmd.timeout)
+	}
+	for {
+		var b DomainJob
+		if _, err := cmd.call(http.MethodGet, path, nil, &b); err != nil {
+			return nil, err
+		}
+		running := b.Status == InProgress
+		if cmd.follow {
+			cmd.exitCode = statusExitCode(b.Status)
+			if running && !deadline.IsZero() && time.Now().After(deadline) {
+				fmt.Fprintf(os.Stderr, "lurch %s: timeout %s expired, job #%s of %s is still running\n", cmd.name, cmd.timeout, job, project)
+				running = false
+			}
+		}
+		if cmd.json {
+			if !cmd.follow || !running {
+				return &b, cmd.printJson(b)
+			}
+		} else if len(b.Output) > printed {
+			io.WriteString(cmd.out, b.Output[printed:])
+			printed = len(b.Output)
+		}
+		if !cmd.follow || !running {
+			return &b, nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Interrupts running job
+func (cmd *cliCommand) interrupt() error {
+	project, err := cmd.arg(0, "project")
+	if err != nil {
+		return err
+	}
+	job, err := cmd.arg(1, "job")
+	if err != nil {
+		return err
+	}
+	var status DomainStatus
+	if _, err := cmd.call(http.MethodPost, "/rest/jobs/"+url.PathEscape(project)+"/interrupt/"+url.PathEscape(job), nil, &status); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJson(status)
+	}
+	fmt.Fprintf(cmd.out, "job #%s of %s interrupted\n", job, project)
+	return nil
+}
+
+// Downloads artifact archive or named artifact of job into file, '-' means standard output
+func (cmd *cliCommand) download() error {
+	project, err := cmd.arg(0, "project")
+	if err != nil {
+		return err
+	}
+	job, err := cmd.jobName(project)
+	if err != nil {
+		return err
+	}
+	path := "/download/" + url.PathEscape(project) + "/" + url.PathEscape(job)
+	if name, err := cmd.arg(2, "artifact"); err == nil {
+		path += "/" + url.PathEscape(name)
+		if cmd.output == "" {
+			cmd.output = name
+		}
+	}
+	body, err := cmd.call(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	w := cmd.out
+	if cmd.output != "-" {
+		if cmd.output == "" {
+			cmd.output = fmt.Sprintf("%s_%s.tar.gz", project, job)
+		}
+		f, err := os.Create(cmd.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// Gets job from arguments or the last job of project
+func (cmd *cliCommand) jobName(project string) (string, error) {
+	if job, err := cmd.arg(1, "job"); err == nil {
+		return job, nil
+	}
+	var p DomainProject
+	if _, err := cmd.call(http.MethodGet, "/rest/projects/"+url.PathEscape(project), nil, &p); err != nil {
+		return "", err
+	}
+	if len(p.Jobs) == 0 {
+		return "", fmt.Errorf("project %s has no jobs", project)
+	}
+	return p.Jobs[0].Name, nil
+}
+
+func formatCliDate(date time.Time) string {
+	if date.Unix() <= 0 {
+		return "-"
+	}
+	return date.Local().Format(time.DateTime)
+}
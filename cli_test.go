@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCliCommand(t *testing.T) {
+	if cmd := parseCliCommand([]string{"-t", "workdir"}); cmd != nil {
+		t.Fatal("TestParseCliCommand: options of server should not be a command")
+	}
+
+	cmd := parseCliCommand([]string{"start", "project", "-P", "KEY=value=1", "--param=OTHER=2", "-s=http://ci:5000/", "-k", "secret", "-f", "-j"})
+	if cmd == nil || cmd.name != "start" || len(cmd.args) != 1 || cmd.args[0] != "project" {
+		t.Fatalf("TestParseCliCommand: unexpected command %v", cmd)
+	}
+	if cmd.server != "http://ci:5000" || cmd.token != "secret" || !cmd.follow || !cmd.json {
+		t.Fatalf("TestParseCliCommand: unexpected options %v", cmd)
+	}
+	if len(cmd.params) != 2 || cmd.params["KEY"] != "value=1" || cmd.params["OTHER"] != "2" {
+		t.Fatalf("TestParseCliCommand: unexpected params %v", cmd.params)
+	}
+
+	cmd = parseCliCommand([]string{"jobs", "project", "-F", "status=failed", "--filter=label=branch=main", "-F", "label=pr"})
+	if filter := cmd.filter.Encode(); filter != "label=branch%3Dmain&label=pr&status=failed" {
+		t.Fatalf("TestParseCliCommand: unexpected filter %s", filter)
+	}
+}
+
+func TestCliCommands(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/", (&RestService{c: c}).HandleFunc)
+	mux.HandleFunc("/", NewWebService(c).HandleFunc)
+	NewWebSocketService(c)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := c.OpenProject("cli")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(p.dir, "script.sh"), []byte("#!/bin/sh\n\necho \"hello $NAME\"\nsleep 1\necho done > result"), 0755)
+
+	run := func(args ...string) (string, int) {
+		cmd := parseCliCommand(append(args, "-s", srv.URL))
+		out := &bytes.Buffer{}
+		cmd.out = out
+		code := cmd.run()
+		return out.String(), code
+	}
+
+	if _, code := run("start"); code == 0 {
+		t.Fatal("TestCliCommands: start without project should fail")
+	}
+
+	if out, code := run("start", "cli", "-P", "name=lurch", "-f"); code != 0 || out != "hello lurch\n" {
+		t.Fatalf("TestCliCommands: unexpected output of start (%d):\n%s", code, out)
+	}
+
+	if cause := c.OpenJob(p, "1").Cause(); cause == nil || cause.Trigger != causeCli || cause.Remote != "127.0.0.1" {
+		t.Fatalf("TestCliCommands: unexpected cause %v", cause)
+	}
+
+	os.WriteFile(filepath.Join(p.dir, "script.sh"), []byte("#!/bin/sh\n\nexit 1"), 0755)
+	if _, code := run("start", "cli", "-f"); code != exitCodeFailed {
+		t.Fatalf("TestCliCommands: following failed job returned %d", code)
+	}
+	if _, code := run("log", "cli", "1", "-f"); code != exitCodeOk {
+		t.Fatalf("TestCliCommands: following finished job returned %d", code)
+	}
+
+	if out, code := run("projects"); code != 0 || !strings.HasPrefix(out, "cli") || !strings.Contains(out, "#2") || !strings.Contains(out, "failed") {
+		t.Fatalf("TestCliCommands: unexpected output of projects (%d):\n%s", code, out)
+	}
+
+	out, code := run("jobs", "cli", "-j")
+	var jobs []DomainJob
+	if err := json.Unmarshal([]byte(out), &jobs); code != 0 || err != nil || len(jobs) != 2 || jobs[1].Status != Finished {
+		t.Fatalf("TestCliCommands: unexpected output of jobs (%d):\n%s", code, out)
+	}
+
+	if out, code := run("log", "cli", "1"); code != 0 || out != "hello lurch\n" {
+		t.Fatalf("TestCliCommands: unexpected output of log (%d):\n%s", code, out)
+	}
+
+	artifact := filepath.Join(tmpdir, "artifact.tar.gz")
+	if _, code := run("download", "cli", "1", "-o", artifact); code != 0 {
+		t.Fatalf("TestCliCommands: download failed")
+	}
+	if stat, err := os.Stat(artifact); err != nil || stat.Size() != c.OpenJob(p, "1").ArtifactSize() {
+		t.Fatalf("TestCliCommands: downloaded artifact does not match")
+	}
+
+	if _, code := run("log", "unknown"); code == 0 {
+		t.Fatal("TestCliCommands: log of unknown project should fail")
+	}
+}
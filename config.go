@@ -7,12 +7,19 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var buildVersion string
 
 const delimiter = "="
 
+const (
+	waitOutputStream = "stream"
+	waitOutputEnd    = "end"
+	waitOutputNone   = "none"
+)
+
 type Config struct {
 	client bool
 	port   int
@@ -21,10 +28,23 @@ type Config struct {
 	name   string
 	action socketAction
 	data   string
+	value  string
+	params map[string]string
+	wait   bool
+
+	waitTimeout time.Duration
+	waitOutput  string
+
+	drainTimeout time.Duration
+	containerCli string
+
+	agentUrl    string
+	agentToken  string
+	agentLabels []string
 }
 
 func LoadConfig(args []string) *Config {
-	c := &Config{port: 5000, name: "lurch"}
+	c := &Config{port: 5000, name: "lurch", drainTimeout: 5 * time.Minute, containerCli: "podman", waitOutput: waitOutputStream}
 	c.setPath("workdir")
 	parseArgs(args, func(arg, value string) {
 		switch arg {
@@ -36,12 +56,68 @@ func LoadConfig(args []string) *Config {
 			c.appUrl = value
 		case "-n", "--name":
 			c.name = value
+		case "-dt", "--drain-timeout":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				c.drainTimeout = time.Duration(seconds) * time.Second
+			}
+		case "-cc", "--container-cli":
+			c.containerCli = value
+		case "-ag", "--agent":
+			c.agentUrl = value
+		case "-at", "--agent-token":
+			c.agentToken = value
+		case "-al", "--agent-labels":
+			for _, label := range strings.Split(value, ",") {
+				if label = strings.TrimSpace(label); label != "" {
+					c.agentLabels = append(c.agentLabels, label)
+				}
+			}
 		case "-sj", "--start-job":
 			c.client = true
 			c.action = socketActionStart
 			c.data = value
+		case "-P", "--param":
+			if k, v, found := strings.Cut(value, delimiter); found {
+				if c.params == nil {
+					c.params = make(map[string]string)
+				}
+				c.params[k] = v
+			}
+		case "-w", "--wait":
+			c.wait = true
+		case "-wt", "--wait-timeout":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				c.waitTimeout = time.Duration(seconds) * time.Second
+			}
+		case "-wo", "--wait-output":
+			if value == waitOutputStream || value == waitOutputEnd || value == waitOutputNone {
+				c.waitOutput = value
+			}
+		case "-ss", "--stage":
+			c.client = true
+			c.action = socketActionStage
+			c.data = value
+		case "-sp", "--stage-progress":
+			c.client = true
+			c.action = socketActionProgress
+			c.data = value
+		case "-sm", "--set-meta":
+			c.client = true
+			c.action = socketActionMeta
+			c.data, c.value, _ = strings.Cut(value, delimiter)
+		case "-sa", "--artifact":
+			c.client = true
+			c.action = socketActionArtifact
+			c.data, c.value, _ = strings.Cut(value, delimiter)
+			if c.value != "" {
+				c.value, _ = filepath.Abs(c.value)
+			}
+		case "-sq", "--status":
+			c.client = true
+			c.action = socketActionStatus
+			c.data = value
 		case "-h", "--help":
-			fmt.Printf("Usage: lurch [options]\nOptions:\n\t-h, --help\t\t\tprint this help\n\t-v, --version\t\t\tprint version\n\t-t, --path [PATH]\t\tabsolute path to work dir\n\t-p, --port [PORT]\t\tsets port for listening\n\t-a, --app-url [APP_URL]\t\tapplication url (if behind proxy)\n\t-n, --name [NAME]\t\tname of application to be displayed\n\t-sj, --start-job [PROJECT]\tmakes client call to origin server and starts the build of [PROJECT]\n")
+			fmt.Printf("Usage: lurch [options]\nOptions:\n\t-h, --help\t\t\tprint this help\n\t-v, --version\t\t\tprint version\n\t-t, --path [PATH]\t\tabsolute path to work dir\n\t-p, --port [PORT]\t\tsets port for listening\n\t-a, --app-url [APP_URL]\t\tapplication url (if behind proxy)\n\t-n, --name [NAME]\t\tname of application to be displayed\n\t-dt, --drain-timeout [SECONDS]\thow long to wait for running jobs on stop\n\t-cc, --container-cli [CLI]\tCLI used for running jobs in containers (podman by default)\n\t-ag, --agent [URL]\t\truns as agent of lurch server on [URL]\n\t-at, --agent-token [TOKEN]\tAPI token used by agent\n\t-al, --agent-labels [LABELS]\tcomma separated labels of agent, os and arch are added\n\t-sj, --start-job [PROJECT]\tmakes client call to origin server and starts the build of [PROJECT]\n\t-P, --param [KEY=VALUE]\t\tparam of job started by client call, could be repeated\n\t-w, --wait\t\t\twaits until job started by client call ends\n\t-wt, --wait-timeout [SECONDS]\tstops waiting after [SECONDS], job keeps running\n\t-wo, --wait-output [MODE]\toutput of waited job: stream (default), end or none\n\t-ss, --stage [NAME]\t\tmakes client call to origin server and starts new stage of running job\n\t-sp, --stage-progress [PERCENT]\tmakes client call to origin server and sets progress of current stage\n\t-sm, --set-meta [KEY=VALUE]\tmakes client call to origin server and sets description, version, badge or label.KEY of running job\n\t-sa, --artifact [NAME=PATH]\tmakes client call to origin server and publishes file from workspace as named artifact\n\t-sq, --status [PROJECT]\t\tmakes client call to origin server and prints status of the last job of [PROJECT]\n\nUsage: lurch [command] [arguments] [options]\nCommands:\n\tprojects\t\t\tlists projects with their last job\n\tjobs [PROJECT]\t\t\tlists history of jobs of [PROJECT] matching filter\n\tstart [PROJECT]\t\t\tstarts new job of [PROJECT]\n\trerun [PROJECT] [JOB]\t\tstarts new job with params of [JOB], the last job by default\n\tlog [PROJECT] [JOB]\t\tprints output of [JOB], the last job by default\n\tinterrupt [PROJECT] [JOB]\tinterrupts running [JOB]\n\tdownload [PROJECT] [JOB] [NAME]\tdownloads artifact archive or named artifact of [JOB], the last job by default\nCommand options:\n\t-s, --server [URL]\t\turl of lurch server (LURCH_SERVER or http://localhost:5000 by default)\n\t-k, --token [TOKEN]\t\tAPI token (LURCH_TOKEN by default)\n\t-P, --param [KEY=VALUE]\t\tparam of started job, overrides param of rerun job, could be repeated\n\t-F, --filter [KEY=VALUE]\tfilter of listed jobs, e.g. status=failed or q=TEXT, could be repeated\n\t-f, --follow\t\t\tprints output until job ends, exit code reflects status of job\n\t-wt, --wait-timeout [SECONDS]\tstops following after [SECONDS]\n\t-o, --output [FILE]\t\tfile for downloaded artifact, '-' for standard output\n\t-j, --json\t\t\tprints result as JSON\n")
 			os.Exit(0)
 		case "-v", "--version":
 			fmt.Printf("lurch %s\nhttps://github.com/tvrzna/lurch\n\nReleased under the MIT License.\n", c.GetVersion())
@@ -79,6 +155,11 @@ func parseArgs(args []string, handler func(arg, nextArg string)) {
 	}
 }
 
+// Checks if lurch runs as agent of another lurch
+func (c *Config) isAgent() bool {
+	return c.agentUrl != ""
+}
+
 func (c *Config) getAppUrl() string {
 	return c.appUrl
 }
@@ -6,15 +6,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Context struct {
@@ -22,17 +25,22 @@ type Context struct {
 	interrupt chan bool
 	conf      *Config
 	jobs      []*Job
+	running   *sync.WaitGroup
+	draining  bool
+	agents    *AgentPool
 	webServer *http.Server
 	wsService *WsService
+	events    *EventHub
 }
 
 // Init new context
 func NewContext(c *Config) *Context {
-	return &Context{conf: c, jobs: make([]*Job, 0), mutex: &sync.Mutex{}, interrupt: make(chan bool)}
+	return &Context{conf: c, jobs: make([]*Job, 0), mutex: &sync.Mutex{}, running: &sync.WaitGroup{}, agents: NewAgentPool(), events: NewEventHub(eventBufferSize), interrupt: make(chan bool)}
 }
 
-func (c *Context) StartJob(p *Project, params map[string]string) string {
-	if p == nil {
+// Starts new job of project with params unless project is disabled, cause of job is recorded in its directory
+func (c *Context) StartJob(p *Project, params map[string]string, cause *JobCause, meta *JobMeta) string {
+	if p == nil || c.IsDraining() || p.Disabled() != nil || isGroupDir(p.dir) {
 		return ""
 	}
 	// Check if project is being built
@@ -45,23 +53,58 @@ func (c *Context) StartJob(p *Project, params map[string]string) string {
 		return ""
 	}
 	b.SetParams(params)
+	b.SaveCause(cause)
+	if err := b.UpdateMeta(meta); err != nil {
+		log.Print("-- could not save metadata of job: ", err)
+	}
 
 	c.mutex.Lock()
+	if c.draining {
+		c.mutex.Unlock()
+		b.SetStatus(Stopped)
+		return ""
+	}
 	c.jobs = append(c.jobs, b)
+	c.running.Add(1)
 	c.mutex.Unlock()
 
 	c.removeOldjobs(p)
 
+	c.publishJob(eventJobQueued, b, Unknown, "")
 	go c.start(b)
 	return b.name
 }
 
+// Starts new job of project with params of existing job, that could be overridden, child of matrix reruns the whole matrix
+func (c *Context) RerunJob(b *Job, overrides map[string]string, cause *JobCause) string {
+	if b == nil {
+		return ""
+	}
+	if b.parent != nil {
+		b = b.parent
+	}
+	if _, err := os.Stat(b.dir); err != nil {
+		return ""
+	}
+
+	b.LoadParams()
+	params := make(map[string]string)
+	maps.Copy(params, b.params)
+	maps.Copy(params, checkParams(overrides))
+
+	if cause == nil {
+		cause = &JobCause{}
+	}
+	cause.RerunOf = b.name
+	return c.StartJob(b.p, params, cause, nil)
+}
+
 func (c *Context) Interrupt(b *Job) {
 	c.mutex.Lock()
 	for _, job := range c.jobs {
-		if b.Equals(job) {
-			log.Printf("-- interrupting job #%s of %s", b.name, b.p.name)
-			job.interrupt <- true
+		if b.Equals(job) || (job.parent != nil && b.Equals(job.parent)) {
+			log.Printf("-- interrupting job #%s of %s", job.name, job.p.name)
+			job.sendInterrupt()
 		}
 	}
 	c.mutex.Unlock()
@@ -71,80 +114,203 @@ func (c *Context) InterruptAll() {
 	c.mutex.Lock()
 	for _, job := range c.jobs {
 		log.Printf("-- interrupting job #%s of %s", job.name, job.p.name)
-		job.interrupt <- true
+		job.sendInterrupt()
 	}
 	c.mutex.Unlock()
 }
 
-func (c *Context) start(b *Job) {
-	log.Printf(">> started job #%s for %s", b.name, b.p.name)
+// Stops accepting new jobs and waits for running ones until timeout, then interrupts the rest
+func (c *Context) Drain(timeout time.Duration) {
+	c.mutex.Lock()
+	c.draining = true
+	c.mutex.Unlock()
+	if c.wsService != nil {
+		c.wsService.Broadcast("{\"draining\": true}")
+	}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command(filepath.Join(b.p.dir, "script.cmd"))
-	} else {
-		cmd = exec.Command("sh", "-c", filepath.Join(b.p.dir, "script.sh"))
+	done := make(chan bool)
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+
+	log.Printf("-- draining, waiting %s for running jobs", timeout)
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
 	}
 
-	b.MkWorkspace()
+	c.InterruptAll()
+	<-done
+}
+
+// Checks if context is draining and no more jobs are accepted
+func (c *Context) IsDraining() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.draining
+}
+
+// Requests stop of lurch, if nobody is waiting for the request, it is ignored
+func (c *Context) Stop() {
+	select {
+	case c.interrupt <- true:
+	default:
+	}
+}
+
+func (c *Context) start(b *Job) {
+	log.Printf(">> started job #%s for %s", b.name, b.p.name)
+	c.execute(b)
+	c.running.Done()
+	log.Printf("<< finished job #%s for %s", b.name, b.p.name)
+}
+
+// Executes job and records its result, job has to be already in slice of running jobs
+func (c *Context) execute(b *Job) JobStatus {
 	b.LogStart()
 	b.SaveParams()
 
-	b.p.SetParams(b.params)
-	b.p.SaveParams()
-
-	socket := startServerSocket(c, b)
-	if socket != nil {
-		defer socket.stop()
+	if b.parent == nil {
+		b.p.SetParams(b.params)
+		b.p.SaveParams()
 	}
 
-	c.setEnv(cmd, b, socket)
-	cmd.Dir = b.WorkspacePath()
 	output, err := os.OpenFile(b.OutputPath(), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
 		b.SetStatus(Failed)
 		c.removeFromSlice(b)
+		c.publishJob(eventJobFinished, b, Failed, "")
 		log.Printf("-- failed to open output for #%s of %s", b.name, b.p.name)
-		return
+		return Failed
 	}
 	defer output.Close()
-	cmd.Stdin = output
-	cmd.Stdout = output
-	cmd.Stderr = output
+	b.stages = newStageTracker(b, output)
+	b.stages.started = func(stage *Stage) {
+		c.publishJob(eventJobStage, b, stage.Status, stage.Name)
+	}
 
-	cmd.Start()
-	go c.watchForInterrupt(b, cmd)
+	go c.watchForInterrupt(b)
+	c.publishJob(eventJobStarted, b, InProgress, "")
 	c.broadcastUpdate(b)
 
-	if err := cmd.Wait(); err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if exiterr.ExitCode() == 0 {
-				b.SetStatus(Finished)
-			} else if b.Status() != Stopped {
-				b.SetStatus(Failed)
-			}
-			output.WriteString(exiterr.String())
-		} else {
-			output.WriteString("\nFailed!")
-			b.SetStatus(Failed)
-		}
+	var status JobStatus
+	if pipeline, err := b.p.LoadPipeline(); err != nil {
+		fmt.Fprintf(b.stages, "could not load %s: %s\n", pipelineFile, err)
+		status = Failed
+	} else if pipeline != nil && len(pipeline.Matrix) > 0 && b.parent == nil && !c.conf.isAgent() {
+		status = c.runMatrix(b, pipeline)
+	} else if len(pipeline.GetAgent()) > 0 && !c.conf.isAgent() {
+		status = c.runOnAgent(b, pipeline.GetAgent())
 	} else {
-		b.SetStatus(Finished)
+		status = c.runInWorkspace(b, pipeline)
 	}
-	close(b.interrupt)
+	if b.isStopped() {
+		status = Stopped
+	}
+	b.SetStatus(status)
+	if err := c.recordStats(b, status); err != nil {
+		log.Print("-- could not record statistics of ", b.p.name, ": ", err)
+	}
+	b.stages.End(status)
 	c.removeFromSlice(b)
+	close(b.interrupt)
+	c.publishJob(eventJobFinished, b, status, "")
+	c.broadcastUpdate(b)
+
+	return status
+}
+
+// Runs pipeline or script of project in workspace, that is archived as artifact afterwards
+func (c *Context) runInWorkspace(b *Job, pipeline *Pipeline) JobStatus {
+	b.MkWorkspace()
+	defer os.RemoveAll(b.WorkspacePath())
+
+	socket := startServerSocket(c, b)
+	if socket != nil {
+		defer socket.stop()
+	}
+
+	e := c.executorFor(pipeline)
+	var status JobStatus
+	if pipeline != nil && len(pipeline.Steps) > 0 {
+		status = c.runPipeline(b, pipeline, e, socket)
+	} else {
+		status = c.runScript(b, e, socket)
+	}
 
 	if err := c.compressFolder(b.ArtifactPath(), b.WorkspacePath()); err != nil {
 		log.Print("-- could not compress", b.WorkspacePath())
 	}
-	os.RemoveAll(b.WorkspacePath())
-	c.broadcastUpdate(b)
+	return status
+}
 
-	log.Printf("<< finished job #%s for %s", b.name, b.p.name)
+// Runs script of project
+func (c *Context) runScript(b *Job, e Executor, socket *socketServerContext) JobStatus {
+	return c.runTask(b, e, &Task{Script: b.p.ScriptPath(), Env: c.jobEnv(b, socket)}, b.stages, 0)
 }
 
-func (c *Context) setEnv(cmd *exec.Cmd, b *Job, socket *socketServerContext) {
-	envs := os.Environ()
+// Runs task writing into output until it ends, job is interrupted or timeout expires
+func (c *Context) runTask(b *Job, e Executor, t *Task, output io.Writer, timeout time.Duration) JobStatus {
+	cmd, err := e.Command(b, t)
+	defer e.Release(t)
+	if err != nil {
+		fmt.Fprintf(output, "\nFailed! %s", err)
+		return Failed
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(output, "\nFailed! %s", err)
+		return Failed
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+
+	status := Finished
+	select {
+	case err = <-done:
+	case <-b.stop:
+		e.Stop(t, cmd)
+		err = <-done
+		status = Stopped
+	case <-timer:
+		e.Stop(t, cmd)
+		err = <-done
+		fmt.Fprintf(output, "\ntimeout %s expired\n", timeout)
+		status = Failed
+	}
+
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			output.Write([]byte(exiterr.String()))
+			if exiterr.ExitCode() != 0 && status == Finished {
+				status = Failed
+			}
+		} else {
+			output.Write([]byte("\nFailed!"))
+			if status == Finished {
+				status = Failed
+			}
+		}
+	}
+	return status
+}
+
+// Gets environment of job made of its params and socket connection
+func (c *Context) jobEnv(b *Job, socket *socketServerContext) []string {
+	envs := make([]string, 0)
 
 	if b.params != nil {
 		for k, v := range b.params {
@@ -157,19 +323,13 @@ func (c *Context) setEnv(cmd *exec.Cmd, b *Job, socket *socketServerContext) {
 		envs = append(envs, fmt.Sprintf("%s=%s", envSocketToken, socket.token))
 	}
 
-	cmd.Env = envs
+	return envs
 }
 
 func (c *Context) removeFromSlice(b *Job) {
 	c.mutex.Lock()
 	if index := c.indexOf(b); index >= 0 {
-		if len(c.jobs) == 1 {
-			c.jobs = c.jobs[:0]
-		} else if index+1 == len(c.jobs) {
-			c.jobs = c.jobs[:index]
-		} else {
-			c.jobs = append(c.jobs[:index], c.jobs[index+1])
-		}
+		c.jobs = slices.Delete(c.jobs, index, index+1)
 	}
 	c.mutex.Unlock()
 }
@@ -183,11 +343,11 @@ func (c *Context) indexOf(b *Job) int {
 	return -1
 }
 
-func (c *Context) watchForInterrupt(b *Job, cmd *exec.Cmd) {
+func (c *Context) watchForInterrupt(b *Job) {
 	status := <-b.interrupt
 	if status {
 		b.SetStatus(Stopped)
-		cmd.Process.Signal(os.Kill)
+		close(b.stop)
 		c.broadcastUpdate(b)
 	}
 }
@@ -201,12 +361,7 @@ func (c *Context) IsBeingBuilt(b *Job) bool {
 func (c *Context) isProjectBeingBuilt(p *Project) bool {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	for _, b := range c.jobs {
-		if b.p.name == p.name {
-			return true
-		}
-	}
-	return false
+	return c.hasJobsOf(p)
 }
 
 func (c *Context) removeOldjobs(p *Project) {
@@ -220,17 +375,12 @@ func (c *Context) removeOldjobs(p *Project) {
 	}
 }
 
+// Lists projects in work dir including projects nested in groups, hidden directories are skipped
 func (c *Context) ListProjects() ([]*Project, error) {
 	result := make([]*Project, 0)
-	entries, err := os.ReadDir(c.conf.path)
-	if err != nil {
+	if err := c.listProjectsIn("", &result); err != nil {
 		return nil, err
 	}
-	for _, e := range entries {
-		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
-			result = append(result, c.OpenProject(e.Name()))
-		}
-	}
 
 	sort.Slice(result, func(i, j int) bool {
 		return strings.Compare(result[i].name, result[j].name) <= 0
@@ -239,11 +389,35 @@ func (c *Context) ListProjects() ([]*Project, error) {
 	return result, nil
 }
 
+// Appends projects in directory of group into result, nested groups are listed recursively
+func (c *Context) listProjectsIn(group string, result *[]*Project) error {
+	entries, err := os.ReadDir(filepath.Join(c.conf.path, filepath.FromSlash(group)))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		name := path.Join(group, e.Name())
+		if depth := strings.Count(name, "/") + 1; depth < maxGroupDepth && isGroupDir(filepath.Join(c.conf.path, filepath.FromSlash(name))) {
+			c.listProjectsIn(name, result)
+		} else if p := c.OpenProject(name); p != nil {
+			*result = append(*result, p)
+		}
+	}
+	return nil
+}
+
+// Opens project by its name, project in group is named by path separated by slash, e.g. backend/api. Name in group
+// could not be a number, because it would be a job of project.
 func (c *Context) OpenProject(name string) *Project {
-	if strings.HasPrefix(name, ".") {
-		return nil
+	for i, segment := range strings.Split(name, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") || strings.Contains(segment, "\\") || (i > 0 && isNumber(segment)) {
+			return nil
+		}
 	}
-	return &Project{name: name, dir: filepath.Join(c.conf.path, name)}
+	return &Project{name: name, dir: filepath.Join(c.conf.path, filepath.FromSlash(name))}
 }
 
 func (c *Context) ListJobs(p *Project) ([]*Job, error) {
@@ -271,6 +445,10 @@ func (c *Context) OpenJob(p *Project, name string) *Job {
 	if p == nil {
 		return nil
 	}
+	if parentName, childName, found := strings.Cut(name, "."); found && isNumber(parentName) && isNumber(childName) {
+		parent := c.OpenJob(p, parentName)
+		return &Job{name: name, dir: parent.childDir(childName), p: p, parent: parent}
+	}
 	return &Job{name: name, dir: filepath.Join(p.dir, name), p: p}
 }
 
@@ -325,5 +503,13 @@ func (c *Context) compressFolder(outputPath, inputPath string) error {
 }
 
 func (c *Context) broadcastUpdate(b *Job) {
-	c.wsService.Broadcast(fmt.Sprintf("{\"update\": \"%s\"}", b.p.name))
+	c.broadcastProjectUpdate(b.p)
+}
+
+// Notifies web UI, that project has changed
+func (c *Context) broadcastProjectUpdate(p *Project) {
+	if c.wsService == nil {
+		return
+	}
+	c.wsService.Broadcast(fmt.Sprintf("{\"update\": \"%s\"}", p.name))
 }
@@ -41,7 +41,7 @@ func TestContext(t *testing.T) {
 		t.Fatalf("TestContext: 2 project were expected, but found %d", len(projects))
 	}
 
-	c.StartJob(p1, map[string]string{"key1": "val1", "_key2": "val2"})
+	c.StartJob(p1, map[string]string{"key1": "val1", "_key2": "val2"}, nil, nil)
 	time.Sleep(3 * time.Second)
 
 	if jobs, err := c.ListJobs(p1); err != nil {
@@ -56,7 +56,7 @@ func TestContext(t *testing.T) {
 		t.Fatalf("TestContext: job ends with unexpected status %s", s.String())
 	}
 
-	c.StartJob(p2, nil)
+	c.StartJob(p2, nil, nil, nil)
 	time.Sleep(2 * time.Second)
 	j := c.OpenJob(p2, strconv.Itoa(p2.LastCount()))
 	if !c.IsBeingBuilt(j) {
@@ -72,3 +72,74 @@ func TestContext(t *testing.T) {
 	}
 
 }
+
+func TestDrain(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p1 := c.OpenProject("project-1")
+	if err = os.MkdirAll(p1.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(p1.dir, "script.sh"), []byte("#!/bin/sh\n\nsleep 60"), 0755)
+
+	if c.StartJob(p1, nil, nil, nil) == "" {
+		t.Fatal("TestDrain: job should be started")
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	c.Drain(time.Second)
+
+	if !c.IsDraining() {
+		t.Fatal("TestDrain: context should be draining")
+	}
+	if s := c.OpenJob(p1, "1").Status(); s != Stopped {
+		t.Fatalf("TestDrain: job has status %s instead of stopped", s.String())
+	}
+	if c.StartJob(p1, nil, nil, nil) != "" {
+		t.Fatal("TestDrain: job should not be started while draining")
+	}
+}
+
+func TestRerunJob(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("project-1")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(p.dir, "script.sh"), []byte("#!/bin/sh\n\necho \"$FIRST $SECOND\""), 0755)
+
+	if c.RerunJob(c.OpenJob(p, "1"), nil, nil) != "" {
+		t.Fatal("TestRerunJob: job that does not exist should not be rerun")
+	}
+
+	c.StartJob(p, map[string]string{"first": "1", "second": "2"}, nil, nil)
+	time.Sleep(500 * time.Millisecond)
+
+	if name := c.RerunJob(c.OpenJob(p, "1"), map[string]string{"second": "3"}, &JobCause{Trigger: causeUI}); name != "2" {
+		t.Fatalf("TestRerunJob: unexpected rerun job '%s'", name)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	j := c.OpenJob(p, "2")
+	if output, _ := j.ReadOutput(); output != "1 3\n" {
+		t.Fatalf("TestRerunJob: unexpected output '%s'", output)
+	}
+	if cause := j.Cause(); cause == nil || cause.Trigger != causeUI || cause.RerunOf != "1" {
+		t.Fatalf("TestRerunJob: unexpected cause %v", cause)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Types of events published to event consumers
+const (
+	eventJobQueued      = "job.queued"
+	eventJobStarted     = "job.started"
+	eventJobStage       = "job.stage"
+	eventJobFinished    = "job.finished"
+	eventProjectChanged = "project.changed"
+	eventLost           = "events.lost"
+)
+
+// Changes of project reported by project.changed event
+const (
+	changeCreated  = "created"
+	changeRenamed  = "renamed"
+	changeCopied   = "copied"
+	changeDeleted  = "deleted"
+	changeDisabled = "disabled"
+	changeEnabled  = "enabled"
+	changeEdited   = "edited"
+)
+
+const (
+	eventBufferSize    = 1000
+	eventQueueSize     = 256
+	eventKeepAliveTime = 30 * time.Second
+)
+
+// Event of job or project published to event consumers
+type Event struct {
+	Id      uint64    `json:"id,omitempty"`
+	Type    string    `json:"type"`
+	Date    time.Time `json:"date"`
+	Project string    `json:"project,omitempty"`
+	Job     string    `json:"job,omitempty"`
+	Stage   string    `json:"stage,omitempty"`
+	Status  JobStatus `json:"status,omitempty"`
+	Change  string    `json:"change,omitempty"`
+	From    string    `json:"from,omitempty"`
+}
+
+// Keeps bounded buffer of the latest events and delivers new events to subscribers
+type EventHub struct {
+	mutex  *sync.Mutex
+	lastId uint64
+	size   int
+	events []*Event
+	subs   map[*EventSubscription]bool
+}
+
+// Subscription to events, that is closed when subscriber could not keep up with published events
+type EventSubscription struct {
+	Events chan *Event
+	Replay []*Event
+}
+
+func NewEventHub(size int) *EventHub {
+	return &EventHub{mutex: &sync.Mutex{}, size: size, subs: make(map[*EventSubscription]bool)}
+}
+
+// Assigns id to event, stores it into buffer and sends it to subscribers, slow subscribers are dropped
+func (h *EventHub) Publish(e *Event) {
+	if e.Date.IsZero() {
+		e.Date = time.Now()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.lastId++
+	e.Id = h.lastId
+	if len(h.events) >= h.size {
+		h.events = h.events[1:]
+	}
+	h.events = append(h.events, e)
+
+	for sub := range h.subs {
+		select {
+		case sub.Events <- e:
+		default:
+			delete(h.subs, sub)
+			close(sub.Events)
+		}
+	}
+}
+
+// Subscribes to new events, events after lastId are replayed if lastId is set, lost events are reported by events.lost event
+func (h *EventHub) Subscribe(lastId *uint64) *EventSubscription {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	sub := &EventSubscription{Events: make(chan *Event, eventQueueSize)}
+	if lastId != nil {
+		// Id newer than the last one was received before restart of lurch
+		restarted := *lastId > h.lastId
+		if restarted || (len(h.events) > 0 && *lastId+1 < h.events[0].Id) {
+			sub.Replay = append(sub.Replay, &Event{Type: eventLost, Date: time.Now()})
+		}
+		for _, e := range h.events {
+			if restarted || e.Id > *lastId {
+				sub.Replay = append(sub.Replay, e)
+			}
+		}
+	}
+	h.subs[sub] = true
+	return sub
+}
+
+// Stops delivery of events to subscription
+func (h *EventHub) Unsubscribe(sub *EventSubscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.subs[sub] {
+		delete(h.subs, sub)
+		close(sub.Events)
+	}
+}
+
+// Gets count of subscribers
+func (h *EventHub) Count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.subs)
+}
+
+// Streams events as Server-Sent Events, replay starts after Last-Event-ID header or lastEventId query parameter
+func (s RestService) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.message(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	lastId, err := parseLastEventId(r)
+	if err != nil {
+		s.message(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := r.URL.Query().Get("project")
+
+	sub := s.c.events.Subscribe(lastId)
+	defer s.c.events.Unsubscribe(sub)
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range sub.Replay {
+		writeServerSentEvent(w, e, filter)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveTime)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if writeServerSentEvent(w, e, filter) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Sends events as JSON messages over WebSocket, replay starts after lastEventId query parameter
+func (h *EventHub) HandleWebSocket(con *websocket.Conn) {
+	defer con.Close()
+
+	lastId, err := parseLastEventId(con.Request())
+	if err != nil {
+		return
+	}
+	filter := con.Request().URL.Query().Get("project")
+
+	sub := h.Subscribe(lastId)
+	defer h.Unsubscribe(sub)
+
+	// Messages of client are not expected, reading detects closed or unresponsive connection
+	closed := make(chan bool)
+	go func() {
+		readWebSocket(con, 2*wsPingInterval, func(data []byte) {})
+		close(closed)
+	}()
+
+	send := func(e *Event) error {
+		if !matchEvent(e, filter) {
+			return nil
+		}
+		con.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return websocket.JSON.Send(con, e)
+	}
+	for _, e := range sub.Replay {
+		if send(e) != nil {
+			return
+		}
+	}
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events:
+			if !ok || send(e) != nil {
+				return
+			}
+		case <-ping.C:
+			if pingWebSocket(con) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Writes event in format of Server-Sent Events, events not matching filter are skipped
+func writeServerSentEvent(w http.ResponseWriter, e *Event, filter string) error {
+	if !matchEvent(e, filter) {
+		return nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.Id > 0 {
+		fmt.Fprintf(w, "id: %d\n", e.Id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+// Checks if event belongs to project or group of projects in filter, events without project always match
+func matchEvent(e *Event, filter string) bool {
+	return filter == "" || e.Project == "" || e.Project == filter || strings.HasPrefix(e.Project, filter+"/")
+}
+
+// Parses id of the last received event, nil is returned if client has not received any event yet
+func parseLastEventId(r *http.Request) (*uint64, error) {
+	value := r.Header.Get("last-event-id")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id of last event '%s'", value)
+	}
+	return &id, nil
+}
+
+// Publishes event of job to event consumers
+func (c *Context) publishJob(eventType string, b *Job, status JobStatus, stage string) {
+	c.events.Publish(&Event{Type: eventType, Project: b.p.name, Job: b.name, Status: status, Stage: stage})
+}
+
+// Publishes change of project to event consumers, from is the original project of renamed or copied one
+func (c *Context) publishProject(change, name, from string) {
+	c.events.Publish(&Event{Type: eventProjectChanged, Project: name, Change: change, From: from})
+}
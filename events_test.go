@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestEventHub(t *testing.T) {
+	h := NewEventHub(3)
+	for i := 0; i < 5; i++ {
+		h.Publish(&Event{Type: eventJobQueued, Project: "project"})
+	}
+
+	if sub := h.Subscribe(nil); len(sub.Replay) != 0 {
+		t.Fatalf("TestEventHub: new subscriber should not get replay, got %d events", len(sub.Replay))
+	}
+
+	id := uint64(3)
+	if sub := h.Subscribe(&id); len(sub.Replay) != 2 || sub.Replay[0].Id != 4 || sub.Replay[1].Id != 5 {
+		t.Fatalf("TestEventHub: unexpected replay %v", sub.Replay)
+	}
+
+	id = 1
+	if sub := h.Subscribe(&id); len(sub.Replay) != 4 || sub.Replay[0].Type != eventLost || sub.Replay[1].Id != 3 {
+		t.Fatalf("TestEventHub: lost events should be reported, got %v", sub.Replay)
+	}
+
+	id = 10
+	if sub := h.Subscribe(&id); len(sub.Replay) != 4 || sub.Replay[0].Type != eventLost {
+		t.Fatalf("TestEventHub: id from before restart should replay the whole buffer, got %v", sub.Replay)
+	}
+
+	h = NewEventHub(3)
+	slow := h.Subscribe(nil)
+	for i := 0; i <= eventQueueSize; i++ {
+		h.Publish(&Event{Type: eventJobQueued, Project: "project"})
+	}
+	if h.Count() != 0 {
+		t.Fatalf("TestEventHub: slow subscriber should be dropped")
+	}
+	count := 0
+	for range slow.Events {
+		count++
+	}
+	if count != eventQueueSize {
+		t.Fatalf("TestEventHub: slow subscriber should get %d events, got %d", eventQueueSize, count)
+	}
+	h.Unsubscribe(slow)
+
+	if !matchEvent(&Event{Project: "group/project"}, "group") || matchEvent(&Event{Project: "group-project"}, "group") || !matchEvent(&Event{Type: eventLost}, "group") {
+		t.Fatalf("TestEventHub: unexpected filtering of events")
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+	mux := http.NewServeMux()
+	mux.Handle(apiPrefix+"/", (&RestService{c: c}).ApiHandler())
+	mux.Handle("/ws/events", websocket.Server{Handler: c.events.HandleWebSocket})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(p.dir, "script.sh"), []byte("#!/bin/sh\n\necho '::stage build::'"), 0755)
+	other := c.OpenProject("other")
+	os.MkdirAll(other.dir, 0755)
+
+	if res, err := http.Get(srv.URL + apiPrefix + "/events?lastEventId=x"); err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("TestEventStream: invalid id of last event should not be accepted")
+	}
+
+	res, err := http.Get(srv.URL + apiPrefix + "/events?project=project")
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("content-type") != "text/event-stream" {
+		t.Fatalf("TestEventStream: unexpected response %d %s", res.StatusCode, res.Header.Get("content-type"))
+	}
+
+	ws, err := websocket.Dial(strings.Replace(srv.URL, "http", "ws", 1)+"/ws/events", "", srv.URL)
+	if err != nil {
+		panic(err)
+	}
+	defer ws.Close()
+	for c.events.Count() < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.DisableProject(other, "", "")
+	c.StartJob(p, nil, nil, nil)
+
+	expected := []string{eventJobQueued, eventJobStarted, eventJobStage, eventJobFinished}
+	var events []*Event
+	r := bufio.NewReader(res.Body)
+	for len(events) < len(expected) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("TestEventStream: could not read stream: %s", err)
+		}
+		if data, found := strings.CutPrefix(line, "data: "); found {
+			var e Event
+			json.Unmarshal([]byte(data), &e)
+			events = append(events, &e)
+		}
+	}
+	c.running.Wait()
+	for i, e := range events {
+		if e.Type != expected[i] || e.Project != "project" || e.Job != "1" {
+			t.Fatalf("TestEventStream: unexpected event %v instead of %s", e, expected[i])
+		}
+	}
+	if events[2].Stage != "build" || events[3].Status != Finished {
+		t.Fatalf("TestEventStream: unexpected stage '%s' or status %s", events[2].Stage, events[3].Status)
+	}
+
+	var e Event
+	if err := websocket.JSON.Receive(ws, &e); err != nil || e.Type != eventProjectChanged || e.Project != "other" || e.Change != changeDisabled {
+		t.Fatalf("TestEventStream: unexpected event over WebSocket %v", e)
+	}
+
+	replay, err := websocket.Dial(strings.Replace(srv.URL, "http", "ws", 1)+"/ws/events?project=project&lastEventId=1", "", srv.URL)
+	if err != nil {
+		panic(err)
+	}
+	defer replay.Close()
+	if err := websocket.JSON.Receive(replay, &e); err != nil || e.Id != 2 || e.Type != eventJobQueued {
+		t.Fatalf("TestEventStream: unexpected replayed event %v", e)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+)
+
+var containerNameFormat = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// Task is a single command executed within workspace of job
+type Task struct {
+	Script    string
+	Run       string
+	Dir       string
+	Env       []string
+	container string
+	release   func()
+}
+
+// Executor prepares commands of tasks, stops them and releases their resources
+type Executor interface {
+	Command(b *Job, t *Task) (*exec.Cmd, error)
+	Stop(t *Task, cmd *exec.Cmd) error
+	Release(t *Task)
+}
+
+// Executes tasks directly on host, optionally restricted by sandbox
+type hostExecutor struct {
+	sandbox *Sandbox
+}
+
+// Executes tasks in OCI container using podman or docker CLI
+type containerExecutor struct {
+	cli     string
+	image   string
+	options []string
+}
+
+// Gets executor defined for project, host executor is the default one
+func (c *Context) executorFor(pipeline *Pipeline) Executor {
+	if pipeline != nil && pipeline.Container != nil {
+		cli := pipeline.Container.Cli
+		if cli == "" {
+			cli = c.conf.containerCli
+		}
+		return &containerExecutor{cli: cli, image: pipeline.Container.Image, options: pipeline.Container.Options}
+	}
+	return &hostExecutor{sandbox: pipeline.GetSandbox()}
+}
+
+func (e *hostExecutor) Command(b *Job, t *Task) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if t.Run != "" {
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", t.Run)
+		} else {
+			cmd = exec.Command("sh", "-e", "-c", t.Run)
+		}
+	} else if runtime.GOOS == "windows" {
+		cmd = exec.Command(t.Script)
+	} else {
+		cmd = exec.Command("sh", "-c", t.Script)
+	}
+	cmd.Env = append(e.sandbox.environ(), t.Env...)
+	cmd.Dir = filepath.Join(b.WorkspacePath(), t.Dir)
+
+	var err error
+	t.release, err = e.sandbox.apply(cmd, b)
+	return cmd, err
+}
+
+func (e *hostExecutor) Stop(t *Task, cmd *exec.Cmd) error {
+	return killProcessGroup(cmd)
+}
+
+func (e *hostExecutor) Release(t *Task) {
+	if t.release != nil {
+		t.release()
+	}
+}
+
+func (e *containerExecutor) Command(b *Job, t *Task) (*exec.Cmd, error) {
+	t.container = containerNameFormat.ReplaceAllString("lurch-"+b.p.name+"-"+b.name+"-"+randomToken(6), "-")
+
+	args := []string{"run", "--rm", "--name", t.container, "-v", b.WorkspacePath() + ":/workspace", "-w", path.Join("/workspace", filepath.ToSlash(t.Dir))}
+	for _, env := range t.Env {
+		args = append(args, "-e", env)
+	}
+	if t.Run == "" {
+		args = append(args, "-v", t.Script+":/lurch/script.sh:ro")
+	}
+	args = append(args, e.options...)
+	args = append(args, e.image)
+	if t.Run != "" {
+		args = append(args, "sh", "-e", "-c", t.Run)
+	} else {
+		args = append(args, "sh", "-c", "/lurch/script.sh")
+	}
+
+	return exec.Command(e.cli, args...), nil
+}
+
+func (e *containerExecutor) Stop(t *Task, cmd *exec.Cmd) error {
+	exec.Command(e.cli, "kill", t.container).Run()
+	return cmd.Process.Kill()
+}
+
+func (e *containerExecutor) Release(t *Task) {
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeContainerCli = `#!/bin/sh
+echo "$*" >> "$(dirname "$0")/calls"
+[ "$1" = run ] || exit 0
+shift
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-v) case "$2" in *:/workspace) ws="${2%:/workspace}";; esac; shift 2;;
+		-w) dir="$2"; shift 2;;
+		-e) export "$2"; shift 2;;
+		--name) shift 2;;
+		test-image) shift; break;;
+		*) shift;;
+	esac
+done
+cd "$ws${dir#/workspace}" && exec "$@"
+`
+
+func TestContainerExecutor(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	cli := filepath.Join(tmpdir, "fake-cli")
+	os.WriteFile(cli, []byte(fakeContainerCli), 0755)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir, "-cc", cli}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("container")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.PipelinePath(), []byte(`container:
+  image: test-image
+  options: [--network=host]
+steps:
+  - name: build
+    run: mkdir dist; echo "$GREETING" > dist/out
+    env:
+      GREETING: hello
+  - name: wait
+    run: sleep 30
+    dir: dist
+`), 0644)
+
+	c.StartJob(p, map[string]string{"key": "value"}, nil, nil)
+	time.Sleep(time.Second)
+
+	j := c.OpenJob(p, "1")
+	c.Interrupt(j)
+	time.Sleep(2 * time.Second)
+
+	if s := j.Status(); s != Stopped {
+		t.Fatalf("TestContainerExecutor: job has status %s instead of stopped", s.String())
+	}
+	if stages := j.Stages(); len(stages) != 2 || stages[0].Status != Finished {
+		t.Fatalf("TestContainerExecutor: unexpected stages %v", stages)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpdir, "calls"))
+	if err != nil {
+		t.Fatal("TestContainerExecutor: container CLI was not called", err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(calls) != 3 {
+		t.Fatalf("TestContainerExecutor: unexpected calls of container CLI:\n%s", data)
+	}
+	for _, s := range []string{"run --rm --name lurch-container-1-", j.WorkspacePath() + ":/workspace -w /workspace ", "-e KEY=value", "-e GREETING=hello", "--network=host test-image sh -e -c mkdir dist"} {
+		if !strings.Contains(calls[0], s) {
+			t.Fatalf("TestContainerExecutor: call '%s' does not contain '%s'", calls[0], s)
+		}
+	}
+	if !strings.Contains(calls[1], "-w /workspace/dist ") {
+		t.Fatalf("TestContainerExecutor: unexpected working directory in '%s'", calls[1])
+	}
+	name := strings.Fields(calls[1])[3]
+	if calls[2] != "kill "+name {
+		t.Fatalf("TestContainerExecutor: container was not killed, got '%s' instead of 'kill %s'", calls[2], name)
+	}
+}
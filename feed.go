@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Maximal count of entries in feed
+const feedLimit = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Id       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Links    []atomLink   `xml:"link"`
+	Category atomCategory `xml:"category"`
+	Summary  string       `xml:"summary"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Gets base url of lurch, application url is preferred to host of request
+func (s *WebService) baseUrl(r *http.Request) string {
+	if appUrl := s.c.conf.getAppUrl(); appUrl != "" {
+		return strings.TrimSuffix(appUrl, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Serves Atom feed of ended jobs of all projects on /feed.atom or of one project on /feed/[PROJECT].atom
+func (s *WebService) serveFeed(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseJobFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base := s.baseUrl(r)
+	feed := &atomFeed{Id: base + r.URL.Path, Title: s.c.conf.name, Author: atomAuthor{Name: s.c.conf.name}}
+	feed.Links = []atomLink{{Href: base + r.URL.RequestURI(), Rel: "self", Type: "application/atom+xml"}, {Href: base + "/", Rel: "alternate", Type: "text/html"}}
+
+	var projects []*Project
+	if r.URL.Path == "/feed.atom" {
+		if projects, err = s.c.ListProjects(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		name, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/feed/"), ".atom")
+		p := s.c.OpenProject(name)
+		if !found || p == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if !p.Exists() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		projects = []*Project{p}
+		feed.Title += " - " + p.name
+	}
+
+	jobs := make([]*Job, 0)
+	for _, p := range projects {
+		if list, err := s.c.ListJobs(p); err == nil {
+			jobStatus := cachedStatus(s.jobStatus)
+			matched, _ := filter.apply(list, jobStatus)
+			for _, b := range matched {
+				if status := jobStatus(b); status == Finished || status == Failed || status == Stopped {
+					jobs = append(jobs, b)
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(jobs, func(a, b *Job) int {
+		return b.EndDate().Compare(a.EndDate())
+	})
+	jobs = jobs[:min(len(jobs), feedLimit)]
+
+	feed.Updated = time.Now().UTC().Format(time.RFC3339)
+	if len(jobs) > 0 {
+		feed.Updated = jobs[0].EndDate().UTC().Format(time.RFC3339)
+	}
+	for _, b := range jobs {
+		feed.Entries = append(feed.Entries, s.feedEntry(base, b))
+	}
+
+	w.Header().Set("content-type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	e.Encode(feed)
+}
+
+// Makes entry of feed describing ended job
+func (s *WebService) feedEntry(base string, b *Job) atomEntry {
+	status := b.Status()
+	detail := base + "/rest/jobs/" + url.PathEscape(b.p.name) + "/" + url.PathEscape(b.name)
+	summary := fmt.Sprintf("Job #%s of %s %s after %s.", b.name, b.p.name, status, b.EndDate().Sub(b.StartDate()).Round(time.Second))
+	if meta := b.Meta(); meta != nil && meta.Description != "" {
+		summary += " " + meta.Description
+	}
+	return atomEntry{
+		Id:       detail,
+		Title:    fmt.Sprintf("%s #%s %s", b.p.name, b.name, status),
+		Updated:  b.EndDate().UTC().Format(time.RFC3339),
+		Links:    []atomLink{{Href: base + "/", Rel: "alternate", Type: "text/html"}, {Href: detail, Rel: "related", Type: "application/json"}},
+		Category: atomCategory{Term: status.String()},
+		Summary:  summary,
+	}
+}
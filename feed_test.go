@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFeed(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir, "-a", "https://ci.example.com/lurch/"}))
+	s := NewWebService(c)
+
+	end := time.Now().Add(-time.Hour)
+	for _, name := range []string{"project-1", "project-2", ".hidden"} {
+		p := c.OpenProject(name)
+		if p == nil {
+			p = &Project{name: name, dir: filepath.Join(tmpdir, name)}
+		}
+		if err = os.MkdirAll(p.dir, 0755); err != nil {
+			panic(err)
+		}
+		for _, status := range []JobStatus{Finished, Failed, Unknown} {
+			b, _ := p.NewJob()
+			b.LogStart()
+			b.SetStatus(status)
+			end = end.Add(time.Minute)
+			os.Chtimes(filepath.Join(b.dir, "status"), end, end)
+		}
+	}
+
+	feed := func(url string) (*atomFeed, int) {
+		w := httptest.NewRecorder()
+		s.HandleFunc(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var result atomFeed
+		if w.Code == http.StatusOK {
+			if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("TestFeed: invalid feed %s: %s", url, err)
+			}
+		}
+		return &result, w.Code
+	}
+
+	all, _ := feed("/feed.atom")
+	if len(all.Entries) != 4 || all.Entries[0].Title != "project-2 #2 failed" || all.Entries[3].Title != "project-1 #1 finished" {
+		t.Fatalf("TestFeed: unexpected entries %v", all.Entries)
+	}
+	if all.Entries[0].Id != "https://ci.example.com/lurch/rest/jobs/project-2/2" || all.Links[0].Href != "https://ci.example.com/lurch/feed.atom" {
+		t.Fatalf("TestFeed: unexpected links %s %v", all.Entries[0].Id, all.Links)
+	}
+
+	failed, _ := feed("/feed/project-1.atom?status=failed")
+	if len(failed.Entries) != 1 || failed.Entries[0].Category.Term != "failed" || failed.Title != "lurch - project-1" {
+		t.Fatalf("TestFeed: unexpected feed of project %v", failed)
+	}
+
+	for _, url := range []string{"/feed/.hidden.atom", "/feed/unknown.atom", "/feed/project-1"} {
+		if _, code := feed(url); code != http.StatusNotFound {
+			t.Fatalf("TestFeed: unexpected code %d for %s", code, url)
+		}
+	}
+	if _, code := feed("/feed.atom?status=broken"); code != http.StatusBadRequest {
+		t.Fatalf("TestFeed: unexpected code %d for invalid filter", code)
+	}
+}
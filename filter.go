@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of jobs to be sorted by
+const (
+	sortByNumber   = "number"
+	sortByStart    = "start"
+	sortByEnd      = "end"
+	sortByDuration = "duration"
+)
+
+// Longest line of output, that is searched by text, the rest of output is skipped
+const maxSearchedLine = 1024 * 1024
+
+// Filter of jobs by their status, dates, metadata, params and output, that also sorts and pages the result
+type jobFilter struct {
+	labels   map[string]string
+	params   map[string]string
+	version  string
+	statuses []JobStatus
+	from     time.Time
+	to       time.Time
+	text     string
+	sort     string
+	asc      bool
+	offset   int
+	limit    int
+}
+
+// Parses filter from query, labels and params are filtered by repeated label=KEY=VALUE or just label=KEY for any value
+func parseJobFilter(query url.Values) (*jobFilter, error) {
+	result := &jobFilter{labels: make(map[string]string), params: make(map[string]string), version: strings.TrimSpace(query.Get("version")), text: strings.ToLower(strings.TrimSpace(query.Get("q"))), sort: sortByNumber}
+	for _, label := range query["label"] {
+		key, value, _ := strings.Cut(label, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			result.labels[key] = strings.TrimSpace(value)
+		}
+	}
+	for _, param := range query["param"] {
+		key, value, _ := strings.Cut(param, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			result.params[strings.ToUpper(key)] = value
+		}
+	}
+
+	for _, statuses := range query["status"] {
+		for _, name := range strings.Split(statuses, ",") {
+			status, found := parseJobStatus(strings.TrimSpace(name))
+			if !found {
+				return nil, fmt.Errorf("unknown status '%s'", name)
+			}
+			result.statuses = append(result.statuses, status)
+		}
+	}
+
+	var err error
+	if result.from, err = parseFilterDate(query.Get("from"), false); err != nil {
+		return nil, err
+	}
+	if result.to, err = parseFilterDate(query.Get("to"), true); err != nil {
+		return nil, err
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if !slices.Contains([]string{sortByNumber, sortByStart, sortByEnd, sortByDuration}, value) {
+			return nil, fmt.Errorf("unknown sort '%s'", value)
+		}
+		result.sort = value
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		result.asc = true
+	default:
+		return nil, fmt.Errorf("unknown order '%s'", query.Get("order"))
+	}
+
+	if result.offset, err = parseFilterNumber(query.Get("offset"), "offset"); err != nil {
+		return nil, err
+	}
+	if result.limit, err = parseFilterNumber(query.Get("limit"), "limit"); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Parses date in RFC 3339 or just day, day of upper bound is included
+func parseFilterDate(value string, upper bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if result, err := time.Parse(time.RFC3339, value); err == nil {
+		return result, nil
+	}
+	result, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date '%s' has incorrect format", value)
+	}
+	if upper {
+		result = result.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return result, nil
+}
+
+// Parses non-negative number, empty value is zero
+func parseFilterNumber(value, name string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 0 {
+		return 0, fmt.Errorf("%s has to be a non-negative number", name)
+	}
+	return result, nil
+}
+
+// Checks if filter has any condition
+func (f *jobFilter) isEmpty() bool {
+	return f == nil || (len(f.labels) == 0 && len(f.params) == 0 && f.version == "" && len(f.statuses) == 0 && f.from.IsZero() && f.to.IsZero() && f.text == "")
+}
+
+// Checks if job with metadata matches filter, status is evaluated only if needed and output of job is searched as the last one
+func (f *jobFilter) matches(b *Job, status func(*Job) JobStatus, meta *JobMeta) bool {
+	if f.isEmpty() {
+		return true
+	}
+	if len(f.statuses) > 0 && !slices.Contains(f.statuses, status(b)) {
+		return false
+	}
+	if !f.from.IsZero() || !f.to.IsZero() {
+		start := b.StartDate()
+		if (!f.from.IsZero() && start.Before(f.from)) || (!f.to.IsZero() && start.After(f.to)) {
+			return false
+		}
+	}
+	if f.version != "" && (meta == nil || meta.Version != f.version) {
+		return false
+	}
+	for key, value := range f.labels {
+		if meta == nil {
+			return false
+		}
+		if v, found := meta.Labels[key]; !found || (value != "" && v != value) {
+			return false
+		}
+	}
+	if len(f.params) > 0 {
+		params := loadParams(b.ParamsPath())
+		for key, value := range f.params {
+			if v, found := params[key]; !found || (value != "" && v != value) {
+				return false
+			}
+		}
+	}
+	if f.text != "" && !outputContains(b.OutputPath(), f.text) {
+		return false
+	}
+	return true
+}
+
+// Searches output line by line for lower case text, reading stops at the first match
+func outputContains(path, text string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSearchedLine)
+	for scanner.Scan() {
+		if bytes.Contains(bytes.ToLower(scanner.Bytes()), []byte(text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wraps status of job, so status of each job is evaluated only once
+func cachedStatus(status func(*Job) JobStatus) func(*Job) JobStatus {
+	statuses := make(map[*Job]JobStatus)
+	return func(b *Job) JobStatus {
+		if result, found := statuses[b]; found {
+			return result
+		}
+		statuses[b] = status(b)
+		return statuses[b]
+	}
+}
+
+// Filters, sorts and pages jobs sorted from the newest one, status of job is provided by caller. Jobs sorted by
+// number are evaluated only until the page is full. It also returns, if there are more jobs after the page.
+func (f *jobFilter) apply(jobs []*Job, status func(*Job) JobStatus) ([]*Job, bool) {
+	if f == nil {
+		return jobs, false
+	}
+	lazy := f.sort == sortByNumber && !f.asc && f.limit > 0
+	result := make([]*Job, 0)
+	for _, b := range jobs {
+		if lazy && len(result) > f.offset+f.limit {
+			break
+		}
+		if f.matches(b, status, b.Meta()) {
+			result = append(result, b)
+		}
+	}
+
+	f.sortJobs(result)
+
+	if f.offset >= len(result) {
+		return []*Job{}, false
+	}
+	result = result[f.offset:]
+	if f.limit > 0 && len(result) > f.limit {
+		return result[:f.limit], true
+	}
+	return result, false
+}
+
+// Sorts jobs by key of filter, jobs are expected to be already sorted by number from the newest one
+func (f *jobFilter) sortJobs(jobs []*Job) {
+	var key func(b *Job) int64
+	switch f.sort {
+	case sortByStart:
+		key = func(b *Job) int64 { return b.StartDate().UnixNano() }
+	case sortByEnd:
+		key = func(b *Job) int64 { return b.EndDate().UnixNano() }
+	case sortByDuration:
+		key = func(b *Job) int64 { return b.EndDate().Sub(b.StartDate()).Nanoseconds() }
+	default:
+		if f.asc {
+			slices.Reverse(jobs)
+		}
+		return
+	}
+
+	keys := make(map[*Job]int64, len(jobs))
+	for _, b := range jobs {
+		keys[b] = key(b)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if f.asc {
+			return keys[jobs[i]] < keys[jobs[j]]
+		}
+		return keys[jobs[i]] > keys[jobs[j]]
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobFilter(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	for i := 1; i <= 5; i++ {
+		b, _ := p.NewJob()
+		b.LogStart()
+		b.SetParams(map[string]string{"target": "prod"})
+		if i%2 == 0 {
+			b.SetParams(map[string]string{"target": "test"})
+			b.SetStatus(Failed)
+		} else {
+			b.SetStatus(Finished)
+		}
+		b.SaveParams()
+		b.UpdateMeta(&JobMeta{Version: "1." + strconv.Itoa(i), Labels: map[string]string{"branch": "main"}})
+		output := "build " + strconv.Itoa(i)
+		if i >= 4 {
+			output += "\nConnection Refused"
+		}
+		os.WriteFile(b.OutputPath(), []byte(output), 0644)
+		os.Chtimes(filepath.Join(b.dir, "start"), time.Time{}, time.Date(2024, 1, i, 12, 0, 0, 0, time.Local))
+		os.Chtimes(filepath.Join(b.dir, "status"), time.Time{}, time.Date(2024, 1, i, 12, 10*(6-i), 0, 0, time.Local))
+	}
+	jobs, _ := c.ListJobs(p)
+
+	filter := func(query string) ([]string, bool) {
+		values, _ := url.ParseQuery(query)
+		f, err := parseJobFilter(values)
+		if err != nil {
+			t.Fatalf("TestJobFilter: unexpected error for '%s': %s", query, err)
+		}
+		result, more := f.apply(jobs, (*Job).Status)
+		names := make([]string, len(result))
+		for i, b := range result {
+			names[i] = b.name
+		}
+		return names, more
+	}
+
+	for query, expected := range map[string]string{
+		"":                               "5,4,3,2,1",
+		"status=failed":                  "4,2",
+		"status=failed,finished&limit=1": "5",
+		"from=2024-01-02&to=2024-01-03":  "3,2",
+		"param=TARGET=prod":              "5,3,1",
+		"param=target":                   "5,4,3,2,1",
+		"label=branch=main&version=1.4":  "4",
+		"label=branch=dev":               "",
+		"label=pr":                       "",
+		"q=connection refused":           "5,4",
+		"q=BUILD 3":                      "3",
+		"sort=duration":                  "1,2,3,4,5",
+		"sort=end&order=asc":             "1,2,3,4,5",
+		"order=asc&offset=1&limit=2":     "2,3",
+		"offset=10":                      "",
+	} {
+		if names, _ := filter(query); strings.Join(names, ",") != expected {
+			t.Fatalf("TestJobFilter: unexpected jobs %v for '%s'", names, query)
+		}
+	}
+
+	if _, more := filter("limit=2"); !more {
+		t.Fatal("TestJobFilter: more jobs should be reported")
+	}
+	if _, more := filter("limit=5"); more {
+		t.Fatal("TestJobFilter: no more jobs should be reported")
+	}
+
+	calls := 0
+	status := cachedStatus(func(b *Job) JobStatus {
+		calls++
+		return b.Status()
+	})
+	values, _ := url.ParseQuery("status=failed")
+	f, _ := parseJobFilter(values)
+	result, _ := f.apply(jobs, status)
+	for _, b := range result {
+		status(b)
+	}
+	if calls != len(jobs) {
+		t.Fatalf("TestJobFilter: status should be evaluated once per job, but it was evaluated %d times", calls)
+	}
+
+	for _, query := range []string{"status=broken", "from=yesterday", "sort=name", "order=up", "limit=-1", "offset=a"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseJobFilter(values); err == nil {
+			t.Fatalf("TestJobFilter: expected error for '%s'", query)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Maximal depth of project nested in groups
+const maxGroupDepth = 5
+
+// Files, that make directory a project instead of a group
+var projectFiles = []string{scriptFile, "script.cmd", pipelineFile, "counter"}
+
+// Group of projects sharing directory in work dir
+type ProjectGroup struct {
+	Name     string    `json:"name"`
+	Status   JobStatus `json:"status"`
+	Projects []string  `json:"projects"`
+}
+
+// Checks if directory is a group of projects, group has no files of project and contains at least one directory, that is not a job
+func isGroupDir(dir string) bool {
+	for _, name := range projectFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return false
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") && !isNumber(e.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if project exists, group of projects is not a project
+func (p *Project) Exists() bool {
+	stat, err := os.Stat(p.dir)
+	return err == nil && stat.IsDir() && !isGroupDir(p.dir)
+}
+
+// Gets name of group of project, empty string is returned for project directly in work dir
+func (p *Project) Group() string {
+	if group := path.Dir(p.name); group != "." {
+		return group
+	}
+	return ""
+}
+
+// Checks if project belongs directly to group, projects of nested groups belong to their own groups as in list of groups
+func (p *Project) InGroup(group string) bool {
+	return group == "" || p.Group() == strings.TrimSuffix(group, "/")
+}
+
+// Lists groups of projects with status aggregated from the latest jobs of their projects
+func (c *Context) ListGroups() ([]*ProjectGroup, error) {
+	projects, err := c.ListProjects()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ProjectGroup, 0)
+	statuses := make(map[string][]JobStatus)
+	for _, p := range projects {
+		group := p.Group()
+		if group == "" {
+			continue
+		}
+		i := slices.IndexFunc(result, func(g *ProjectGroup) bool { return g.Name == group })
+		if i < 0 {
+			i = len(result)
+			result = append(result, &ProjectGroup{Name: group, Projects: make([]string, 0)})
+		}
+		result[i].Projects = append(result[i].Projects, p.name)
+		statuses[group] = append(statuses[group], c.latestStatus(p))
+	}
+	for _, g := range result {
+		g.Status = aggregateStatus(statuses[g.Name])
+	}
+	return result, nil
+}
+
+// Gets status of the latest job of project, running job is always in progress
+func (c *Context) latestStatus(p *Project) JobStatus {
+	jobs, err := c.ListJobs(p)
+	if err != nil || len(jobs) == 0 {
+		return Unknown
+	}
+	if c.IsBeingBuilt(jobs[0]) {
+		return InProgress
+	}
+	return jobs[0].Status()
+}
+
+// Aggregates statuses of projects into status of group, running project wins over failed, stopped and finished ones
+func aggregateStatus(statuses []JobStatus) JobStatus {
+	for _, status := range []JobStatus{InProgress, Failed, Stopped, Finished} {
+		if slices.Contains(statuses, status) {
+			return status
+		}
+	}
+	return Unknown
+}
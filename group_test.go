@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAggregateStatus(t *testing.T) {
+	for expected, statuses := range map[JobStatus][]JobStatus{
+		Unknown:    nil,
+		Finished:   {Finished, Unknown},
+		Stopped:    {Finished, Stopped},
+		Failed:     {Stopped, Failed, Finished},
+		InProgress: {Failed, InProgress},
+	} {
+		if status := aggregateStatus(statuses); status != expected {
+			t.Fatalf("TestAggregateStatus: unexpected status %s of %v", status, statuses)
+		}
+	}
+}
+
+func TestProjectGroups(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+
+	for name, file := range map[string]string{
+		"alpha":             scriptFile,
+		"backend/api":       scriptFile,
+		"backend/web":       "counter",
+		"backend/tools/cli": pipelineFile,
+		"plain/1":           "status",
+		".hidden/project":   scriptFile,
+		"backend/.old/x":    scriptFile,
+	} {
+		dir := filepath.Join(tmpdir, filepath.FromSlash(name))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			panic(err)
+		}
+		os.WriteFile(filepath.Join(dir, file), []byte("#!/bin/sh\n"), 0755)
+	}
+
+	projects, err := c.ListProjects()
+	if err != nil {
+		t.Fatalf("TestProjectGroups: projects should be listed: %v", err)
+	}
+	names := make([]string, len(projects))
+	for i, p := range projects {
+		names[i] = p.name
+	}
+	if !slices.Equal(names, []string{"alpha", "backend/api", "backend/tools/cli", "backend/web", "plain"}) {
+		t.Fatalf("TestProjectGroups: unexpected projects %v", names)
+	}
+
+	if c.OpenProject("backend/../alpha") != nil || c.OpenProject("backend//api") != nil || c.OpenProject("backend/.old/x") != nil || c.OpenProject("alpha/1") != nil {
+		t.Fatal("TestProjectGroups: invalid name should not be opened")
+	}
+	if c.OpenProject("backend").Exists() || c.OpenProject("backend/tools").Exists() || !c.OpenProject("backend/api").Exists() {
+		t.Fatal("TestProjectGroups: group should not be a project")
+	}
+	if c.StartJob(c.OpenProject("backend"), nil, nil, nil) != "" {
+		t.Fatal("TestProjectGroups: job of group should not be started")
+	}
+
+	api := c.OpenProject("backend/api")
+	b, _ := api.NewJob()
+	b.SetStatus(Failed)
+	b, _ = c.OpenProject("backend/web").NewJob()
+	b.SetStatus(Finished)
+
+	groups, err := c.ListGroups()
+	if err != nil || len(groups) != 2 {
+		t.Fatalf("TestProjectGroups: unexpected groups %v", groups)
+	}
+	if g := groups[0]; g.Name != "backend" || g.Status != Failed || !slices.Equal(g.Projects, []string{"backend/api", "backend/web"}) {
+		t.Fatalf("TestProjectGroups: unexpected group %v", g)
+	}
+	if g := groups[1]; g.Name != "backend/tools" || g.Status != Unknown || !slices.Equal(g.Projects, []string{"backend/tools/cli"}) {
+		t.Fatalf("TestProjectGroups: unexpected group %v", g)
+	}
+
+	if _, err := c.CreateProject("alpha/nested", ""); err == nil {
+		t.Fatal("TestProjectGroups: project should not be nested in project")
+	}
+	p, err := c.CreateProject("frontend/app", "")
+	if err != nil || !p.Exists() || p.Group() != "frontend" {
+		t.Fatalf("TestProjectGroups: project should be created in group: %v", err)
+	}
+	if p, err = c.RenameProject(p, "web/app"); err != nil {
+		t.Fatalf("TestProjectGroups: project should be moved to another group: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "frontend")); err == nil {
+		t.Fatal("TestProjectGroups: empty group should be removed")
+	}
+	if err := c.DeleteProject(p); err != nil {
+		t.Fatalf("TestProjectGroups: project should be deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "web")); err == nil {
+		t.Fatal("TestProjectGroups: empty group should be removed")
+	}
+
+	s := &RestService{c: c}
+	get := func(url string, result any) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		if url[:4] == "/api" {
+			s.ApiHandler().ServeHTTP(w, r)
+		} else {
+			s.HandleFunc(w, r)
+		}
+		json.Unmarshal(w.Body.Bytes(), result)
+		return w.Code
+	}
+
+	var list []DomainProject
+	if code := get("/rest/projects?group=backend", &list); code != http.StatusOK || len(list) != 2 || list[0].Name != "backend/api" || list[1].Name != "backend/web" {
+		t.Fatalf("TestProjectGroups: unexpected projects of group %d %v", code, list)
+	}
+	if code := get("/api/v1/projects?group=backend/tools", &list); code != http.StatusOK || len(list) != 1 || list[0].Name != "backend/tools/cli" {
+		t.Fatalf("TestProjectGroups: unexpected projects of nested group %d %v", code, list)
+	}
+	var project DomainProject
+	if code := get("/rest/projects/backend%2Fapi", &project); code != http.StatusOK || project.Name != "backend/api" || len(project.Jobs) != 1 {
+		t.Fatalf("TestProjectGroups: unexpected project %d %v", code, project)
+	}
+	if code := get("/api/v1/projects/backend%2Fapi/jobs/1", &DomainJob{}); code != http.StatusOK {
+		t.Fatalf("TestProjectGroups: unexpected response %d to job in group", code)
+	}
+	c.OpenProject("alpha").NewJob()
+	w := httptest.NewRecorder()
+	s.HandleFunc(w, httptest.NewRequest(http.MethodPost, "/rest/jobs/alpha%2F1/start", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("TestProjectGroups: job should not be started in job of another project, got %d", w.Code)
+	}
+	if code := get("/rest/projects/backend", &project); code != http.StatusNotFound {
+		t.Fatalf("TestProjectGroups: group should not be found as project, got %d", code)
+	}
+	var domainGroups []ProjectGroup
+	if code := get("/api/v1/groups", &domainGroups); code != http.StatusOK || len(domainGroups) != 2 || domainGroups[0].Status != Failed {
+		t.Fatalf("TestProjectGroups: unexpected groups %d %v", code, domainGroups)
+	}
+	for _, g := range domainGroups {
+		get("/api/v1/projects?group="+g.Name, &list)
+		names := make([]string, len(list))
+		for i, p := range list {
+			names[i] = p.Name
+		}
+		if !slices.Equal(names, g.Projects) {
+			t.Fatalf("TestProjectGroups: projects %v of group %s do not match list of groups %v", names, g.Name, g.Projects)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	NewWebService(c).HandleFunc(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `lurch-group="backend/tools"`) || !strings.Contains(body, `ajsf="backend/tools/cli"`) {
+		t.Fatalf("TestProjectGroups: unexpected index %d", w.Code)
+	}
+}
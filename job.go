@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -39,15 +40,21 @@ func (b *JobStatus) UnmarshalJSON(data []byte) error {
 	var v string
 	json.Unmarshal(data, &v)
 
-	*b = map[string]JobStatus{
+	*b, _ = parseJobStatus(v)
+
+	return nil
+}
+
+// Parses job status from its name, unknown status is returned for unknown name
+func parseJobStatus(value string) (JobStatus, bool) {
+	result, found := map[string]JobStatus{
 		"unknown":    Unknown,
 		"finished":   Finished,
 		"stopped":    Stopped,
 		"failed":     Failed,
 		"inprogress": InProgress,
-	}[v]
-
-	return nil
+	}[value]
+	return result, found
 }
 
 type Job struct {
@@ -55,7 +62,10 @@ type Job struct {
 	dir       string
 	p         *Project
 	interrupt chan bool
+	stop      chan bool
 	params    map[string]string
+	stages    *stageTracker
+	parent    *Job
 }
 
 // Get status of job
@@ -139,14 +149,37 @@ func (b *Job) SetParams(params map[string]string) {
 	b.params = checkParams(params)
 }
 
+// Path to params of job
+func (b *Job) ParamsPath() string {
+	return filepath.Join(b.dir, "params")
+}
+
 // Saves params into file
 func (b *Job) SaveParams() error {
-	return saveParams(filepath.Join(b.dir, "params"), b.params)
+	return saveParams(b.ParamsPath(), b.params)
 }
 
 // Loads params from file into map, if not found, leave method without drama
 func (b *Job) LoadParams() {
-	b.params = loadParams(filepath.Join(b.dir, "params"))
+	b.params = loadParams(b.ParamsPath())
+}
+
+// Sends interrupt to job without blocking, repeated interrupts are ignored
+func (b *Job) sendInterrupt() {
+	select {
+	case b.interrupt <- true:
+	default:
+	}
+}
+
+// Checks if job was interrupted
+func (b *Job) isStopped() bool {
+	select {
+	case <-b.stop:
+		return true
+	default:
+		return false
+	}
 }
 
 func (b *Job) ArtifactSize() int64 {
@@ -156,3 +189,61 @@ func (b *Job) ArtifactSize() int64 {
 	}
 	return stat.Size()
 }
+
+// Path to file with stages of job
+func (b *Job) StagesPath() string {
+	return filepath.Join(b.dir, "stages")
+}
+
+// Get stages of job
+func (b *Job) Stages() []Stage {
+	return loadStages(b.StagesPath())
+}
+
+// Makes directory of new job and prepares it to be started
+func (b *Job) init() error {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return err
+	}
+	b.SetStatus(Unknown)
+	b.interrupt = make(chan bool, 1)
+	b.stop = make(chan bool)
+	return nil
+}
+
+// Path to directory of child job
+func (b *Job) childDir(name string) string {
+	return filepath.Join(b.dir, "matrix", name)
+}
+
+// Create new child job of matrix build
+func (b *Job) NewChild(no int) (*Job, error) {
+	name := strconv.Itoa(no)
+	child := &Job{name: b.name + "." + name, dir: b.childDir(name), p: b.p, parent: b}
+	if err := child.init(); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// List child jobs of matrix build
+func (b *Job) Children() []*Job {
+	entries, err := os.ReadDir(filepath.Join(b.dir, "matrix"))
+	if err != nil {
+		return nil
+	}
+	result := make([]*Job, 0)
+	for _, e := range entries {
+		if e.IsDir() && isNumber(e.Name()) {
+			result = append(result, &Job{name: b.name + "." + e.Name(), dir: b.childDir(e.Name()), p: b.p, parent: b})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		cI, _ := strconv.Atoi(filepath.Base(result[i].dir))
+		cJ, _ := strconv.Atoi(filepath.Base(result[j].dir))
+		return cI < cJ
+	})
+
+	return result
+}
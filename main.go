@@ -11,13 +11,25 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxExecArg {
+		os.Exit(sandboxExec(os.Args[2:]))
+	}
+
+	if cmd := parseCliCommand(os.Args[1:]); cmd != nil {
+		os.Exit(cmd.run())
+	}
+
 	c := NewContext(LoadConfig(os.Args))
 
 	if c.conf.client {
-		os.Exit(makeSocketClientAction(c.conf.action, c.conf.data))
+		os.Exit(makeSocketClientAction(c.conf, os.Stdout))
 	}
 
-	go runWebServer(c)
+	if c.conf.isAgent() {
+		go runAgent(c)
+	} else {
+		go runWebServer(c)
+	}
 
 	handleStop(c)
 }
@@ -26,7 +38,10 @@ func runWebServer(c *Context) {
 	mux := http.NewServeMux()
 
 	mux.Handle("/ws/", websocket.Handler(NewWebSocketService(c).HandleWebSocket))
+	mux.Handle("/ws/events", websocket.Server{Handler: c.events.HandleWebSocket})
 	mux.HandleFunc("/rest/", (&RestService{c: c}).HandleFunc)
+	mux.Handle(apiPrefix+"/", (&RestService{c: c}).ApiHandler())
+	mux.HandleFunc("/metrics", NewMetricsService(c).HandleFunc)
 	mux.HandleFunc("/", NewWebService(c).HandleFunc)
 	c.webServer = &http.Server{Handler: mux, Addr: c.conf.getServerUri()}
 
@@ -49,7 +64,12 @@ func handleStop(c *Context) {
 	}
 
 	log.Print("-- stopping lurch")
-	c.InterruptAll()
+	go func() {
+		<-ch
+		log.Print("-- forced stop")
+		c.InterruptAll()
+	}()
+	c.Drain(c.conf.drainTimeout)
 	if c.webServer != nil {
 		c.webServer.Close()
 	}
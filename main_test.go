@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Test binary is also used as a sandbox helper
+	if len(os.Args) > 1 && os.Args[1] == sandboxExecArg {
+		os.Exit(sandboxExec(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	errInvalidName     = errors.New("invalid name of project")
+	errInvalidSettings = errors.New("invalid settings of project")
+	errProjectExists   = errors.New("project already exists")
+	errProjectNotFound = errors.New("project not found")
+	errProjectBuilding = errors.New("project is being built")
+)
+
+// Settings of project editable through API
+type ProjectSettings struct {
+	Params   map[string]string `json:"params"`
+	Pipeline string            `json:"pipeline"`
+}
+
+// Checks that name of project is a path of directories, that could not escape work dir, groups of project must not be projects
+func (c *Context) validateProjectName(name string) error {
+	segments := strings.Split(name, "/")
+	if c.OpenProject(name) == nil || len(segments) > maxGroupDepth || strings.Contains(name, ":") || strings.IndexFunc(name, unicode.IsControl) >= 0 || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("%w '%s'", errInvalidName, name)
+	}
+	for i := 1; i < len(segments); i++ {
+		group := strings.Join(segments[:i], "/")
+		for _, file := range projectFiles {
+			if _, err := os.Stat(filepath.Join(c.conf.path, filepath.FromSlash(group), file)); err == nil {
+				return fmt.Errorf("%w '%s', %s is a project", errInvalidName, name, group)
+			}
+		}
+	}
+	return nil
+}
+
+// Creates new project with build script
+func (c *Context) CreateProject(name, script string) (*Project, error) {
+	if err := c.validateProjectName(name); err != nil {
+		return nil, err
+	}
+	p := c.OpenProject(name)
+	if err := os.MkdirAll(filepath.Dir(p.dir), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(p.dir, 0755); errors.Is(err, os.ErrExist) {
+		return nil, errProjectExists
+	} else if err != nil {
+		return nil, err
+	}
+	if script == "" {
+		script = "#!/bin/sh\n"
+	}
+	if err := p.SaveScript(script); err != nil {
+		os.RemoveAll(p.dir)
+		return nil, err
+	}
+	c.publishProject(changeCreated, p.name, "")
+	c.broadcastProjects()
+	return p, nil
+}
+
+// Renames project including its history, project must not be built
+func (c *Context) RenameProject(p *Project, name string) (*Project, error) {
+	if err := c.validateProjectName(name); err != nil {
+		return nil, err
+	}
+	result := c.OpenProject(name)
+	if err := c.moveProject(p, result.dir); err != nil {
+		return nil, err
+	}
+	c.publishProject(changeRenamed, result.name, p.name)
+	c.broadcastProjects()
+	return result, nil
+}
+
+// Copies script and settings of project into new project, history is not copied
+func (c *Context) CopyProject(p *Project, name string) (*Project, error) {
+	if err := c.validateProjectName(name); err != nil {
+		return nil, err
+	}
+	result := c.OpenProject(name)
+	entries, err := os.ReadDir(p.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errProjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(result.dir), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(result.dir, 0755); errors.Is(err, os.ErrExist) {
+		return nil, errProjectExists
+	} else if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name() == "counter" || e.Name() == "stats" || e.Name() == "disabled" {
+			continue
+		}
+		target := filepath.Join(result.dir, e.Name())
+		if err := copyFile(filepath.Join(p.dir, e.Name()), target); err != nil {
+			os.RemoveAll(result.dir)
+			return nil, err
+		}
+		if info, err := e.Info(); err == nil {
+			os.Chmod(target, info.Mode().Perm())
+		}
+	}
+	c.publishProject(changeCopied, result.name, p.name)
+	c.broadcastProjects()
+	return result, nil
+}
+
+// Disables project, that keeps its history and stays visible, but no job could be started
+func (c *Context) DisableProject(p *Project, reason, user string) error {
+	if !p.Exists() {
+		return errProjectNotFound
+	}
+	if err := p.SetDisabled(&ProjectDisabled{Reason: reason, User: user, Date: time.Now()}); err != nil {
+		return err
+	}
+	c.publishProject(changeDisabled, p.name, "")
+	c.broadcastProjectUpdate(p)
+	return nil
+}
+
+// Enables disabled project
+func (c *Context) EnableProject(p *Project) error {
+	if !p.Exists() {
+		return errProjectNotFound
+	}
+	if err := p.SetDisabled(nil); err != nil {
+		return err
+	}
+	c.publishProject(changeEnabled, p.name, "")
+	c.broadcastProjectUpdate(p)
+	return nil
+}
+
+// Deletes project including its history, project must not be built. Project is hidden while mutex is locked and its
+// files are removed afterwards, so other jobs could start meanwhile.
+func (c *Context) DeleteProject(p *Project) error {
+	hidden := filepath.Join(filepath.Dir(p.dir), ".deleted-"+filepath.Base(p.dir)+"-"+randomToken(6))
+	if err := c.withIdleProject(p, func() error { return os.Rename(p.dir, hidden) }); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(hidden); err != nil {
+		log.Print("-- could not remove files of deleted project ", p.name, ": ", err)
+	}
+	c.removeEmptyGroups(filepath.Dir(p.dir))
+	c.publishProject(changeDeleted, p.name, "")
+	c.broadcastProjects()
+	return nil
+}
+
+// Moves directory of project, that is not being built, to new path
+func (c *Context) moveProject(p *Project, path string) error {
+	err := c.withIdleProject(p, func() error {
+		if _, err := os.Lstat(path); err == nil {
+			return errProjectExists
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.Rename(p.dir, path)
+	})
+	if err != nil {
+		return err
+	}
+	c.removeEmptyGroups(filepath.Dir(p.dir))
+	return nil
+}
+
+// Removes empty directories of groups up to work dir
+func (c *Context) removeEmptyGroups(dir string) {
+	for root := filepath.Clean(c.conf.path); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// Performs action with existing project, that is not being built, no job of project could be started meanwhile
+func (c *Context) withIdleProject(p *Project, action func() error) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.hasJobsOf(p) {
+		return errProjectBuilding
+	}
+	if !p.Exists() {
+		return errProjectNotFound
+	}
+	return action()
+}
+
+// Checks if any job of project is being built, mutex must be locked
+func (c *Context) hasJobsOf(p *Project) bool {
+	for _, b := range c.jobs {
+		if b.p.name == p.name {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifies web UI, that list of projects has changed
+func (c *Context) broadcastProjects() {
+	if c.wsService != nil {
+		c.wsService.Broadcast("{\"projects\": true}")
+	}
+}
+
+// Reads build script of project
+func (p *Project) ReadScript() (string, error) {
+	data, err := os.ReadFile(p.ScriptPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// Saves executable build script of project
+func (p *Project) SaveScript(script string) error {
+	if err := os.WriteFile(p.ScriptPath(), []byte(script), 0755); err != nil {
+		return err
+	}
+	return os.Chmod(p.ScriptPath(), 0755)
+}
+
+// Loads settings of project
+func (p *Project) LoadSettings() (*ProjectSettings, error) {
+	p.LoadParams()
+	data, err := os.ReadFile(p.PipelinePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &ProjectSettings{Params: p.params, Pipeline: string(data)}, nil
+}
+
+// Saves settings of project, pipeline definition is validated before and removed if empty
+func (p *Project) SaveSettings(settings *ProjectSettings) error {
+	if strings.TrimSpace(settings.Pipeline) != "" {
+		if _, err := parsePipeline(settings.Pipeline); err != nil {
+			return fmt.Errorf("%w: %s", errInvalidSettings, err.Error())
+		}
+		if err := os.WriteFile(p.PipelinePath(), []byte(settings.Pipeline), 0644); err != nil {
+			return err
+		}
+	} else if err := os.Remove(p.PipelinePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	p.params = checkParams(settings.Params)
+	if len(p.params) == 0 {
+		if err := os.Remove(p.ParamsPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return p.SaveParams()
+}
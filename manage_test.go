@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateProjectName(t *testing.T) {
+	c := NewContext(LoadConfig([]string{"-t", os.TempDir()}))
+
+	for _, name := range []string{"project", "my-project_1", "Project 2", "backend/api", "a/b/c/d/e"} {
+		if err := c.validateProjectName(name); err != nil {
+			t.Fatalf("TestValidateProjectName: '%s' should be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", ".hidden", "../escape", "a/../b", "a//b", "a/", "a/.b", "a/1", "a/b/c/d/e/f", "a\\b", "/root", "c:", "line\nbreak"} {
+		if err := c.validateProjectName(name); err == nil {
+			t.Fatalf("TestValidateProjectName: '%s' should not be valid", name)
+		}
+	}
+}
+
+func TestManageProject(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+
+	p, err := c.CreateProject("project", "#!/bin/sh\n\necho $VALUE")
+	if err != nil {
+		t.Fatalf("TestManageProject: project should be created: %v", err)
+	}
+	if stat, err := os.Stat(p.ScriptPath()); err != nil || stat.Mode().Perm()&0100 == 0 {
+		t.Fatal("TestManageProject: script should be executable")
+	}
+	if _, err := c.CreateProject("project", ""); err != errProjectExists {
+		t.Fatalf("TestManageProject: existing project should not be created: %v", err)
+	}
+	if _, err := c.CreateProject("../project", ""); err == nil {
+		t.Fatal("TestManageProject: project outside work dir should not be created")
+	}
+
+	if err := p.SaveSettings(&ProjectSettings{Pipeline: "unknown: key\n"}); err == nil {
+		t.Fatal("TestManageProject: invalid pipeline should not be saved")
+	}
+	if err := p.SaveSettings(&ProjectSettings{Params: map[string]string{"value": "1", "-": "2"}, Pipeline: "steps:\n  - make build\n"}); err != nil {
+		t.Fatalf("TestManageProject: settings should be saved: %v", err)
+	}
+	if settings, err := c.OpenProject("project").LoadSettings(); err != nil || len(settings.Params) != 1 || settings.Params["VALUE"] != "1" || settings.Pipeline != "steps:\n  - make build\n" {
+		t.Fatalf("TestManageProject: unexpected settings %v", settings)
+	}
+	p.NewJob()
+
+	copied, err := c.CopyProject(p, "copy")
+	if err != nil {
+		t.Fatalf("TestManageProject: project should be copied: %v", err)
+	}
+	if script, _ := copied.ReadScript(); script != "#!/bin/sh\n\necho $VALUE" {
+		t.Fatalf("TestManageProject: unexpected script of copy '%s'", script)
+	}
+	if jobs, _ := c.ListJobs(copied); len(jobs) != 0 || copied.LastCount() != 0 {
+		t.Fatal("TestManageProject: history should not be copied")
+	}
+	if _, err := c.CopyProject(p, "copy"); err != errProjectExists {
+		t.Fatalf("TestManageProject: project should not be copied over existing one: %v", err)
+	}
+
+	renamed, err := c.RenameProject(p, "renamed")
+	if err != nil {
+		t.Fatalf("TestManageProject: project should be renamed: %v", err)
+	}
+	if jobs, _ := c.ListJobs(renamed); len(jobs) != 1 {
+		t.Fatal("TestManageProject: history should be renamed with project")
+	}
+	if _, err := c.RenameProject(p, "other"); err != errProjectNotFound {
+		t.Fatalf("TestManageProject: missing project should not be renamed: %v", err)
+	}
+	if _, err := c.RenameProject(renamed, "copy"); err != errProjectExists {
+		t.Fatalf("TestManageProject: project should not be renamed to existing one: %v", err)
+	}
+
+	if err := c.DisableProject(renamed, "migration", "admin"); err != nil {
+		t.Fatalf("TestManageProject: project should be disabled: %v", err)
+	}
+	if projects, _ := c.ListProjects(); len(projects) != 2 {
+		t.Fatalf("TestManageProject: disabled project should be still listed")
+	}
+	if disabled := c.OpenProject("renamed").Disabled(); disabled == nil || disabled.Reason != "migration" || disabled.User != "admin" || disabled.Date.IsZero() {
+		t.Fatalf("TestManageProject: unexpected state of disabled project %v", disabled)
+	}
+	if c.StartJob(renamed, nil, nil, nil) != "" {
+		t.Fatal("TestManageProject: job of disabled project should not be started")
+	}
+	if jobs, _ := c.ListJobs(renamed); len(jobs) != 1 {
+		t.Fatal("TestManageProject: history of disabled project should be kept")
+	}
+	if err := c.EnableProject(renamed); err != nil || renamed.Disabled() != nil {
+		t.Fatalf("TestManageProject: project should be enabled: %v", err)
+	}
+	if err := c.DisableProject(c.OpenProject("missing"), "", ""); err != errProjectNotFound {
+		t.Fatalf("TestManageProject: missing project should not be disabled: %v", err)
+	}
+
+	if err := c.DeleteProject(copied); err != nil {
+		t.Fatalf("TestManageProject: project should be deleted: %v", err)
+	}
+	if projects, _ := c.ListProjects(); len(projects) != 1 || projects[0].name != "renamed" {
+		t.Fatalf("TestManageProject: unexpected projects after delete")
+	}
+	entries, _ := os.ReadDir(c.conf.path)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".deleted-") {
+			t.Fatalf("TestManageProject: files of deleted project should be removed, found %s", e.Name())
+		}
+	}
+
+	os.WriteFile(renamed.ScriptPath(), []byte("#!/bin/sh\n\nsleep 60"), 0755)
+	NewWebSocketService(c)
+	c.StartJob(renamed, nil, nil, nil)
+	if err := c.DeleteProject(renamed); err != errProjectBuilding {
+		t.Fatalf("TestManageProject: project being built should not be deleted: %v", err)
+	}
+	if !renamed.Exists() {
+		t.Fatal("TestManageProject: project being built should be kept")
+	}
+	c.InterruptAll()
+}
+
+func TestManageProjectApi(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	api := (&RestService{c: c}).ApiHandler()
+	os.WriteFile(filepath.Join(tmpdir, ".tokens"), []byte("admin=secret\n"), 0600)
+
+	call := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tc := range []struct {
+		method, url, token, body string
+		code                     int
+	}{
+		{http.MethodPost, "/api/v1/projects", "", `{"name": "project"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/projects", "wrong", `{"name": "project"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/projects", "secret", `{"name": "../project"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/projects", "secret", `{"name": "project", "script": "#!/bin/sh\n"}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/projects", "secret", `{"name": "project"}`, http.StatusConflict},
+		{http.MethodGet, "/api/v1/projects/project/script", "", "", http.StatusUnauthorized},
+		{http.MethodPut, "/api/v1/projects/project/script", "secret", "#!/bin/sh\n\necho edited", http.StatusOK},
+		{http.MethodPut, "/api/v1/projects/project/settings", "secret", `{"pipeline": "unknown: key"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/projects/project/settings", "secret", `{"params": {"key": "value"}}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/projects/project/copy", "secret", `{"name": "copy"}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/projects/project/rename", "secret", `{"name": "copy"}`, http.StatusConflict},
+		{http.MethodPost, "/api/v1/projects/project/rename", "secret", `{"name": "renamed"}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/projects/renamed/disable", "", `{"reason": "migration"}`, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/projects/renamed/disable", "secret", `{"reason": "migration"}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/projects/renamed/jobs", "", "", http.StatusConflict},
+		{http.MethodPost, "/api/v1/projects/renamed/enable", "secret", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/projects/missing/enable", "secret", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/projects/copy", "secret", "", http.StatusOK},
+		{http.MethodDelete, "/api/v1/projects/copy", "secret", "", http.StatusNotFound},
+	} {
+		if w := call(tc.method, tc.url, tc.token, tc.body); w.Code != tc.code {
+			t.Fatalf("TestManageProjectApi: unexpected response %d '%s' to %s %s", w.Code, w.Body.String(), tc.method, tc.url)
+		}
+	}
+
+	w := call(http.MethodGet, "/api/v1/projects/renamed/script", "secret", "")
+	if w.Code != http.StatusOK || w.Body.String() != "#!/bin/sh\n\necho edited" || !strings.HasPrefix(w.Header().Get("content-type"), "text/plain") {
+		t.Fatalf("TestManageProjectApi: unexpected script %d '%s'", w.Code, w.Body.String())
+	}
+
+	w = call(http.MethodGet, "/api/v1/projects/renamed/settings", "secret", "")
+	var settings ProjectSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &settings); err != nil || settings.Params["KEY"] != "value" {
+		t.Fatalf("TestManageProjectApi: unexpected settings '%s'", w.Body.String())
+	}
+
+	call(http.MethodPost, "/api/v1/projects/renamed/disable", "secret", `{"reason": "migration"}`)
+	w = call(http.MethodGet, "/api/v1/projects/renamed", "", "")
+	var project DomainProject
+	if err := json.Unmarshal(w.Body.Bytes(), &project); err != nil || project.Disabled == nil || project.Disabled.Reason != "migration" || project.Disabled.User != "admin" {
+		t.Fatalf("TestManageProjectApi: unexpected disabled project '%s'", w.Body.String())
+	}
+	if w = call(http.MethodPost, "/api/v1/projects/renamed/jobs", "", ""); !strings.Contains(w.Body.String(), "project is disabled: migration") {
+		t.Fatalf("TestManageProjectApi: unexpected response '%s' to job of disabled project", w.Body.String())
+	}
+
+	web := NewWebService(c)
+	for url, code := range map[string]int{"/edit?project=renamed": http.StatusOK, "/edit?project=copy": http.StatusNotFound, "/edit?project=..": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		web.HandleFunc(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != code {
+			t.Fatalf("TestManageProjectApi: unexpected response %d to editor %s", w.Code, url)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Runs child job for each combination of matrix parameters concurrently, status of parent job is aggregated
+// from statuses of its children
+func (c *Context) runMatrix(b *Job, pipeline *Pipeline) JobStatus {
+	combinations := pipeline.Combinations()
+	children := make([]*Job, len(combinations))
+	for i, combination := range combinations {
+		child, err := b.NewChild(i + 1)
+		if err != nil {
+			fmt.Fprintf(b.stages, "could not create job #%s.%d: %s\n", b.name, i+1, err)
+			return Failed
+		}
+		params := make(map[string]string)
+		maps.Copy(params, b.params)
+		maps.Copy(params, checkParams(combination))
+		child.SetParams(params)
+		children[i] = child
+	}
+
+	c.mutex.Lock()
+	c.jobs = append(c.jobs, children...)
+	c.mutex.Unlock()
+
+	statuses := make([]JobStatus, len(children))
+	wg := &sync.WaitGroup{}
+	for i, child := range children {
+		fmt.Fprintf(b.stages, "started job #%s with %s\n", child.name, formatParams(combinations[i]))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = c.execute(child)
+			fmt.Fprintf(b.stages, "job #%s %s\n", child.name, statuses[i].String())
+		}()
+	}
+	wg.Wait()
+
+	result := Finished
+	for _, status := range statuses {
+		if status == Failed {
+			return Failed
+		} else if status != Finished {
+			result = status
+		}
+	}
+	return result
+}
+
+// Formats params into sorted list of key=value pairs
+func formatParams(params map[string]string) string {
+	result := make([]string, 0, len(params))
+	for k, v := range params {
+		result = append(result, k+"="+v)
+	}
+	sort.Strings(result)
+	return strings.Join(result, " ")
+}
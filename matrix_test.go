@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinations(t *testing.T) {
+	p, err := parsePipeline("matrix:\n  goos: [linux, windows]\n  GOARCH: [amd64, arm64]\n  go: 1.23\n")
+	if err != nil {
+		t.Fatal("TestCombinations: unexpected error", err)
+	}
+	combinations := p.Combinations()
+	if len(combinations) != 4 {
+		t.Fatalf("TestCombinations: unexpected count of combinations %d", len(combinations))
+	}
+	expected := []string{
+		"GOARCH=amd64 go=1.23 goos=linux",
+		"GOARCH=amd64 go=1.23 goos=windows",
+		"GOARCH=arm64 go=1.23 goos=linux",
+		"GOARCH=arm64 go=1.23 goos=windows",
+	}
+	for i, e := range expected {
+		if f := formatParams(combinations[i]); f != e {
+			t.Fatalf("TestCombinations: unexpected combination '%s' instead of '%s'", f, e)
+		}
+	}
+
+	for _, data := range []string{"matrix:\n  1KEY: [a]", "matrix:\n  KEY: []", "matrix: [a, b]"} {
+		if _, err := parsePipeline(data); err == nil {
+			t.Fatalf("TestCombinations: expected error for '%s'", data)
+		}
+	}
+}
+
+func TestRunMatrix(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("matrix")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.PipelinePath(), []byte("matrix:\n  os: [linux, windows]\n  arch: amd64\n"), 0644)
+	os.WriteFile(filepath.Join(p.dir, "script.sh"), []byte("#!/bin/sh\n\necho \"$OS/$ARCH/$EXTRA\" > target\nsleep 1\n[ \"$OS\" = linux ]"), 0755)
+
+	c.StartJob(p, map[string]string{"EXTRA": "param", "OS": "overridden"}, nil, nil)
+	time.Sleep(500 * time.Millisecond)
+
+	j := c.OpenJob(p, "1")
+	children := j.Children()
+	if len(children) != 2 {
+		t.Fatalf("TestRunMatrix: unexpected count of children %d", len(children))
+	}
+	if !c.IsBeingBuilt(j) || !c.IsBeingBuilt(children[0]) {
+		t.Fatal("TestRunMatrix: parent and children should be running")
+	}
+	time.Sleep(2 * time.Second)
+
+	if s := j.Status(); s != Failed {
+		t.Fatalf("TestRunMatrix: parent job has status %s instead of failed", s.String())
+	}
+
+	child := c.OpenJob(p, "1.1")
+	if child.parent == nil || child.dir != children[0].dir {
+		t.Fatalf("TestRunMatrix: child job opened from unexpected dir '%s'", child.dir)
+	}
+	if s := child.Status(); s != Finished {
+		t.Fatalf("TestRunMatrix: child job #1.1 has status %s instead of finished", s.String())
+	}
+	if s := c.OpenJob(p, "1.2").Status(); s != Failed {
+		t.Fatalf("TestRunMatrix: child job #1.2 has status %s instead of failed", s.String())
+	}
+	if child.ArtifactSize() <= 0 {
+		t.Fatal("TestRunMatrix: child job should have an artifact")
+	}
+	child.LoadParams()
+	if child.params["OS"] != "linux" || child.params["ARCH"] != "amd64" || child.params["EXTRA"] != "param" {
+		t.Fatalf("TestRunMatrix: unexpected params of child %v", child.params)
+	}
+
+	output, _ := j.ReadOutput()
+	if !strings.Contains(output, "started job #1.2 with arch=amd64 os=windows") || !strings.Contains(output, "job #1.2 failed") {
+		t.Fatalf("TestRunMatrix: unexpected output of parent:\n%s", output)
+	}
+	if jobs, _ := c.ListJobs(p); len(jobs) != 1 {
+		t.Fatalf("TestRunMatrix: children should not be listed as jobs of project")
+	}
+}
+
+func TestRemoveFinishedChildren(t *testing.T) {
+	c := NewContext(LoadConfig([]string{}))
+	p := &Project{name: "matrix"}
+	parent := &Job{name: "1", p: p}
+	c.jobs = append(c.jobs, parent)
+	for i := 1; i <= 5; i++ {
+		c.jobs = append(c.jobs, &Job{name: fmt.Sprintf("1.%d", i), p: p, parent: parent})
+	}
+
+	running := map[string]bool{"1": true, "1.1": true, "1.2": true, "1.3": true, "1.4": true, "1.5": true}
+	for _, name := range []string{"1.3", "1.1", "1.5", "1.2"} {
+		c.removeFromSlice(&Job{name: name, p: p})
+		delete(running, name)
+		for n := range running {
+			if !c.IsBeingBuilt(&Job{name: n, p: p}) {
+				t.Fatalf("TestRemoveFinishedChildren: job #%s should be running after #%s finished", n, name)
+			}
+		}
+		if len(c.jobs) != len(running) {
+			t.Fatalf("TestRemoveFinishedChildren: expected %d running jobs, got %d", len(running), len(c.jobs))
+		}
+	}
+}
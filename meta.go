@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var artifactNameFormat = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+var labelKeyFormat = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_./-]*$`)
+
+var metaMutex = &sync.Mutex{}
+
+// Metadata of job set by build script or API
+type JobMeta struct {
+	Description string            `json:"description,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Badges      []string          `json:"badges,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// Path to metadata of job
+func (b *Job) MetaPath() string {
+	return filepath.Join(b.dir, "meta")
+}
+
+// Loads metadata of job, if not found nil is returned
+func (b *Job) Meta() *JobMeta {
+	data, err := os.ReadFile(b.MetaPath())
+	if err != nil {
+		return nil
+	}
+	var result JobMeta
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return &result
+}
+
+// Saves metadata of job
+func (b *Job) SaveMeta(meta *JobMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.MetaPath(), data, 0644)
+}
+
+// Sets description, version, badge or label (label.KEY) of job, badges are appended and empty badge removes all of them
+func (b *Job) SetMeta(key, value string) error {
+	metaMutex.Lock()
+	defer metaMutex.Unlock()
+
+	meta := b.Meta()
+	if meta == nil {
+		meta = &JobMeta{}
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "description":
+		meta.Description = value
+	case "version":
+		meta.Version = value
+	case "badge":
+		if value == "" {
+			meta.Badges = nil
+		} else if !slices.Contains(meta.Badges, value) {
+			meta.Badges = append(meta.Badges, value)
+		}
+	default:
+		label, found := strings.CutPrefix(key, "label.")
+		if !found {
+			return fmt.Errorf("unknown metadata '%s'", key)
+		}
+		if err := meta.setLabel(label, value); err != nil {
+			return err
+		}
+	}
+	return b.SaveMeta(meta)
+}
+
+// Merges metadata into metadata of job, empty values are ignored except labels, that are removed by empty value
+func (b *Job) UpdateMeta(update *JobMeta) error {
+	if update == nil {
+		return nil
+	}
+	metaMutex.Lock()
+	defer metaMutex.Unlock()
+
+	meta := b.Meta()
+	if meta == nil {
+		meta = &JobMeta{}
+	}
+	if description := strings.TrimSpace(update.Description); description != "" {
+		meta.Description = description
+	}
+	if version := strings.TrimSpace(update.Version); version != "" {
+		meta.Version = version
+	}
+	for _, badge := range update.Badges {
+		if badge = strings.TrimSpace(badge); badge != "" && !slices.Contains(meta.Badges, badge) {
+			meta.Badges = append(meta.Badges, badge)
+		}
+	}
+	for key, value := range update.Labels {
+		if err := meta.setLabel(key, strings.TrimSpace(value)); err != nil {
+			return err
+		}
+	}
+	return b.SaveMeta(meta)
+}
+
+// Checks metadata before it is merged into metadata of job
+func (m *JobMeta) Validate() error {
+	if m == nil {
+		return nil
+	}
+	for key := range m.Labels {
+		if !labelKeyFormat.MatchString(key) {
+			return fmt.Errorf("label '%s' has incorrect format", key)
+		}
+	}
+	return nil
+}
+
+// Sets label of metadata, empty value removes it
+func (m *JobMeta) setLabel(key, value string) error {
+	if !labelKeyFormat.MatchString(key) {
+		return fmt.Errorf("label '%s' has incorrect format", key)
+	}
+	if value == "" {
+		delete(m.Labels, key)
+		return nil
+	}
+	if m.Labels == nil {
+		m.Labels = make(map[string]string)
+	}
+	m.Labels[key] = value
+	return nil
+}
+
+// Path to directory with named artifacts
+func (b *Job) ArtifactsDir() string {
+	return filepath.Join(b.dir, "artifacts")
+}
+
+// Lists names of published artifacts
+func (b *Job) Artifacts() []string {
+	entries, err := os.ReadDir(b.ArtifactsDir())
+	if err != nil {
+		return nil
+	}
+	result := make([]string, 0)
+	for _, e := range entries {
+		if !e.IsDir() {
+			result = append(result, e.Name())
+		}
+	}
+	return result
+}
+
+// Path to named artifact, empty string is returned for invalid name
+func (b *Job) NamedArtifactPath(name string) string {
+	if !artifactNameFormat.MatchString(name) {
+		return ""
+	}
+	return filepath.Join(b.ArtifactsDir(), name)
+}
+
+// Copies file from workspace into named artifacts of job
+func (b *Job) PublishArtifact(name, path string) error {
+	target := b.NamedArtifactPath(name)
+	if target == "" {
+		return fmt.Errorf("artifact name '%s' has incorrect format", name)
+	}
+
+	workspace, err := filepath.EvalSymlinks(b.WorkspacePath())
+	if err != nil {
+		return fmt.Errorf("job has no workspace")
+	}
+	source, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("artifact file not found")
+	}
+	if rel, err := filepath.Rel(workspace, source); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("artifact has to be in workspace")
+	}
+	if stat, err := os.Stat(source); err != nil || !stat.Mode().IsRegular() {
+		return fmt.Errorf("artifact has to be a regular file")
+	}
+
+	return copyFile(source, target)
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
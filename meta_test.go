@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUpdateMeta(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	b, _ := p.NewJob()
+
+	b.UpdateMeta(&JobMeta{Description: "Fix login", Badges: []string{"nightly"}, Labels: map[string]string{"branch": "main", "pr": "12"}})
+	b.UpdateMeta(&JobMeta{Version: "1.2.3", Badges: []string{"nightly", "green"}, Labels: map[string]string{"pr": ""}})
+	b.SetMeta("label.team", "core")
+	if err := b.UpdateMeta(&JobMeta{Labels: map[string]string{"../key": "value"}}); err == nil {
+		t.Fatal("TestUpdateMeta: label with incorrect key should fail")
+	}
+
+	meta := b.Meta()
+	if meta == nil || meta.Description != "Fix login" || meta.Version != "1.2.3" || len(meta.Badges) != 2 {
+		t.Fatalf("TestUpdateMeta: unexpected metadata %v", meta)
+	}
+	if len(meta.Labels) != 2 || meta.Labels["branch"] != "main" || meta.Labels["team"] != "core" {
+		t.Fatalf("TestUpdateMeta: unexpected labels %v", meta.Labels)
+	}
+}
+
+func TestSetMeta(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	b, _ := p.NewJob()
+
+	for _, badge := range []string{"nightly", " green ", "nightly"} {
+		if err := b.SetMeta("badge", badge); err != nil {
+			t.Fatalf("TestSetMeta: badge '%s' should be set: %v", badge, err)
+		}
+	}
+	if meta := b.Meta(); meta == nil || !slices.Equal(meta.Badges, []string{"nightly", "green"}) {
+		t.Fatalf("TestSetMeta: badges should be appended once %v", meta)
+	}
+	b.SetMeta("description", "Nightly build")
+	if err := b.SetMeta("badge", ""); err != nil {
+		t.Fatalf("TestSetMeta: badges should be cleared: %v", err)
+	}
+	if meta := b.Meta(); meta == nil || len(meta.Badges) != 0 || meta.Description != "Nightly build" {
+		t.Fatalf("TestSetMeta: unexpected metadata after clearing badges %v", meta)
+	}
+
+	if err := b.SetMeta("unknown", "value"); err == nil {
+		t.Fatal("TestSetMeta: unknown metadata should fail")
+	}
+	if err := b.SetMeta("label.../key", "value"); err == nil {
+		t.Fatal("TestSetMeta: label with incorrect key should fail")
+	}
+	if err := (&JobMeta{Labels: map[string]string{"../key": "value"}}).Validate(); err == nil {
+		t.Fatal("TestSetMeta: metadata with incorrect label should not be valid")
+	}
+}
+
+func TestPublishArtifact(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	b, _ := p.NewJob()
+	workspace := b.WorkspacePath()
+	if err = os.MkdirAll(filepath.Join(workspace, "dist"), 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(workspace, "dist", "app.bin"), []byte("binary"), 0644)
+	os.WriteFile(filepath.Join(tmpdir, "secret"), []byte("secret"), 0644)
+	os.Symlink(filepath.Join(tmpdir, "secret"), filepath.Join(workspace, "link"))
+
+	if err := b.PublishArtifact("app.bin", filepath.Join(workspace, "dist", "app.bin")); err != nil {
+		t.Fatalf("TestPublishArtifact: artifact should be published: %v", err)
+	}
+	if data, _ := os.ReadFile(b.NamedArtifactPath("app.bin")); string(data) != "binary" {
+		t.Fatalf("TestPublishArtifact: unexpected content of artifact '%s'", data)
+	}
+
+	for name, path := range map[string]string{
+		"outside": filepath.Join(tmpdir, "secret"),
+		"escaped": filepath.Join(workspace, "..", "..", "..", "secret"),
+		"link":    filepath.Join(workspace, "link"),
+		"dir":     filepath.Join(workspace, "dist"),
+		"missing": filepath.Join(workspace, "missing"),
+		"../name": filepath.Join(workspace, "dist", "app.bin"),
+		".hidden": filepath.Join(workspace, "dist", "app.bin"),
+	} {
+		if err := b.PublishArtifact(name, path); err == nil {
+			t.Fatalf("TestPublishArtifact: artifact '%s' from '%s' should be rejected", name, path)
+		}
+	}
+	if artifacts := b.Artifacts(); !slices.Equal(artifacts, []string{"app.bin"}) {
+		t.Fatalf("TestPublishArtifact: unexpected artifacts %v", artifacts)
+	}
+}
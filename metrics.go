@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of buckets of job duration histogram in seconds
+var metricsDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 1800, 3600, 7200}
+
+// Interval of refreshing metrics, that need to read files of jobs or whole work dir
+const metricsRefreshInterval = time.Minute
+
+type MetricsService struct {
+	c           *Context
+	mutex       *sync.Mutex
+	projects    []*projectMetrics
+	workdirSize int64
+}
+
+// Creates service with collected metrics of projects and work dir, that are refreshed in background
+func NewMetricsService(c *Context) *MetricsService {
+	s := &MetricsService{c: c, mutex: &sync.Mutex{}}
+	s.refresh()
+	go func() {
+		ticker := time.NewTicker(metricsRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.refresh()
+		}
+	}()
+	return s
+}
+
+// Collects metrics of projects and size of work dir, so scrape does not need to read files
+func (s *MetricsService) refresh() {
+	var stats []*projectMetrics
+	if projects, err := s.c.ListProjects(); err == nil {
+		stats = make([]*projectMetrics, len(projects))
+		for i, p := range projects {
+			stats[i] = s.collectProject(p)
+		}
+	}
+	size := s.collectWorkdirSize()
+
+	s.mutex.Lock()
+	s.projects = stats
+	s.workdirSize = size
+	s.mutex.Unlock()
+}
+
+// Label of metric sample
+type metricLabel struct {
+	name  string
+	value string
+}
+
+// Writer of metrics in Prometheus text format
+type metricsWriter struct {
+	w io.Writer
+}
+
+// Writes help and type of metric family
+func (m *metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Writes sample of metric with labels
+func (m *metricsWriter) sample(name string, value float64, labels ...metricLabel) {
+	io.WriteString(m.w, name)
+	if len(labels) > 0 {
+		values := make([]string, len(labels))
+		for i, l := range labels {
+			values[i] = l.name + "=\"" + escapeMetricLabel(l.value) + "\""
+		}
+		io.WriteString(m.w, "{"+strings.Join(values, ",")+"}")
+	}
+	io.WriteString(m.w, " "+strconv.FormatFloat(value, 'g', -1, 64)+"\n")
+}
+
+// Escapes value of label as required by Prometheus text format
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+// Statistics of jobs of project kept in history
+type projectMetrics struct {
+	name         string
+	builds       int
+	statuses     map[JobStatus]int
+	buckets      []int
+	durations    int
+	durationSum  float64
+	artifactSize int64
+}
+
+// Collects statistics of jobs of project
+func (s *MetricsService) collectProject(p *Project) *projectMetrics {
+	result := &projectMetrics{name: p.name, builds: p.LastCount(), statuses: make(map[JobStatus]int), buckets: make([]int, len(metricsDurationBuckets))}
+	jobs, err := s.c.ListJobs(p)
+	if err != nil {
+		return result
+	}
+	for _, b := range jobs {
+		status := b.Status()
+		if s.c.IsBeingBuilt(b) {
+			status = InProgress
+		}
+		result.statuses[status]++
+
+		if size := b.ArtifactSize(); size > 0 {
+			result.artifactSize += size
+		}
+
+		if status == InProgress || status == Unknown {
+			continue
+		}
+		duration := b.EndDate().Sub(b.StartDate()).Seconds()
+		if duration < 0 {
+			continue
+		}
+		result.durations++
+		result.durationSum += duration
+		for i, bound := range metricsDurationBuckets {
+			if duration <= bound {
+				result.buckets[i]++
+			}
+		}
+	}
+	return result
+}
+
+// Gets size of all files in work dir
+func (s *MetricsService) collectWorkdirSize() int64 {
+	var result int64
+	filepath.WalkDir(s.c.conf.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				result += info.Size()
+			}
+		}
+		return nil
+	})
+	return result
+}
+
+// Writes metrics of lurch in Prometheus text format
+func (s *MetricsService) HandleFunc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+	m := &metricsWriter{w: w}
+
+	s.c.mutex.Lock()
+	running := len(s.c.jobs)
+	draining := s.c.draining
+	s.c.mutex.Unlock()
+	queued := s.c.agents.Queued()
+
+	m.family("lurch_jobs_running", "gauge", "Count of running jobs.")
+	m.sample("lurch_jobs_running", float64(max(running-queued, 0)))
+	m.family("lurch_jobs_queued", "gauge", "Count of jobs waiting for agent.")
+	m.sample("lurch_jobs_queued", float64(queued))
+	m.family("lurch_agents", "gauge", "Count of connected agents.")
+	m.sample("lurch_agents", float64(len(s.c.agents.List())))
+
+	clients := 0
+	if s.c.wsService != nil {
+		clients = s.c.wsService.Count()
+	}
+	m.family("lurch_websocket_clients", "gauge", "Count of connected WebSocket clients.")
+	m.sample("lurch_websocket_clients", float64(clients))
+
+	m.family("lurch_draining", "gauge", "Whether lurch is draining and no jobs are accepted.")
+	if draining {
+		m.sample("lurch_draining", 1)
+	} else {
+		m.sample("lurch_draining", 0)
+	}
+
+	s.mutex.Lock()
+	stats := s.projects
+	workdirSize := s.workdirSize
+	s.mutex.Unlock()
+
+	m.family("lurch_workdir_size_bytes", "gauge", "Size of all files in work dir.")
+	m.sample("lurch_workdir_size_bytes", float64(workdirSize))
+
+	m.family("lurch_project_builds_total", "counter", "Count of jobs ever started for project.")
+	for _, p := range stats {
+		m.sample("lurch_project_builds_total", float64(p.builds), metricLabel{"project", p.name})
+	}
+
+	m.family("lurch_project_jobs", "gauge", "Count of jobs kept in history of project by status.")
+	for _, p := range stats {
+		for _, status := range []JobStatus{Finished, Failed, Stopped, InProgress, Unknown} {
+			m.sample("lurch_project_jobs", float64(p.statuses[status]), metricLabel{"project", p.name}, metricLabel{"status", status.String()})
+		}
+	}
+
+	m.family("lurch_job_duration_seconds", "histogram", "Duration of ended jobs kept in history of project.")
+	for _, p := range stats {
+		for i, bound := range metricsDurationBuckets {
+			m.sample("lurch_job_duration_seconds_bucket", float64(p.buckets[i]), metricLabel{"project", p.name}, metricLabel{"le", strconv.FormatFloat(bound, 'g', -1, 64)})
+		}
+		m.sample("lurch_job_duration_seconds_bucket", float64(p.durations), metricLabel{"project", p.name}, metricLabel{"le", "+Inf"})
+		m.sample("lurch_job_duration_seconds_sum", p.durationSum, metricLabel{"project", p.name})
+		m.sample("lurch_job_duration_seconds_count", float64(p.durations), metricLabel{"project", p.name})
+	}
+
+	m.family("lurch_project_artifacts_size_bytes", "gauge", "Size of artifact archives kept in history of project.")
+	for _, p := range stats {
+		m.sample("lurch_project_artifacts_size_bytes", float64(p.artifactSize), metricLabel{"project", p.name})
+	}
+}
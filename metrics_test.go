@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("project \"1\"")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	for i, status := range []JobStatus{Finished, Failed, Failed} {
+		b, _ := p.NewJob()
+		b.LogStart()
+		b.SetStatus(status)
+		start := time.Now().Add(-time.Hour)
+		os.Chtimes(filepath.Join(b.dir, "start"), start, start)
+		end := start.Add(time.Duration(20*(i+1)) * time.Second)
+		os.Chtimes(filepath.Join(b.dir, "status"), end, end)
+		os.WriteFile(b.ArtifactPath(), make([]byte, 100), 0644)
+	}
+
+	s := NewMetricsService(c)
+	w := httptest.NewRecorder()
+	s.HandleFunc(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("content-type"), "text/plain") {
+		t.Fatalf("TestMetrics: unexpected response %d", w.Code)
+	}
+
+	metrics := w.Body.String()
+	for _, line := range []string{
+		"lurch_jobs_running 0",
+		"lurch_websocket_clients 0",
+		"lurch_project_builds_total{project=\"project \\\"1\\\"\"} 3",
+		"lurch_project_jobs{project=\"project \\\"1\\\"\",status=\"failed\"} 2",
+		"lurch_project_jobs{project=\"project \\\"1\\\"\",status=\"finished\"} 1",
+		"lurch_job_duration_seconds_bucket{project=\"project \\\"1\\\"\",le=\"30\"} 1",
+		"lurch_job_duration_seconds_bucket{project=\"project \\\"1\\\"\",le=\"60\"} 3",
+		"lurch_job_duration_seconds_bucket{project=\"project \\\"1\\\"\",le=\"+Inf\"} 3",
+		"lurch_job_duration_seconds_sum{project=\"project \\\"1\\\"\"} 120",
+		"lurch_project_artifacts_size_bytes{project=\"project \\\"1\\\"\"} 300",
+		"# TYPE lurch_job_duration_seconds histogram",
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Fatalf("TestMetrics: missing '%s' in:\n%s", line, metrics)
+		}
+	}
+	if !strings.Contains(metrics, "lurch_workdir_size_bytes ") || strings.Contains(metrics, "lurch_workdir_size_bytes 0\n") {
+		t.Fatalf("TestMetrics: unexpected size of work dir:\n%s", metrics)
+	}
+
+	b, _ := p.NewJob()
+	b.SetStatus(Finished)
+	for i, expected := range []string{"3", "4"} {
+		w = httptest.NewRecorder()
+		s.HandleFunc(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if line := "lurch_project_builds_total{project=\"project \\\"1\\\"\"} " + expected + "\n"; !strings.Contains(w.Body.String(), line) {
+			t.Fatalf("TestMetrics: metrics should be refreshed only in background, missing '%s' in scrape %d:\n%s", line, i, w.Body.String())
+		}
+		s.refresh()
+	}
+}
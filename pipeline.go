@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var matrixParamFormat = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type Pipeline struct {
+	Env       map[string]string
+	Steps     []*PipelineStep
+	Matrix    map[string][]string
+	Container *ContainerConfig
+	Sandbox   *Sandbox
+	Agent     []string
+}
+
+type ContainerConfig struct {
+	Image   string
+	Cli     string
+	Options []string
+}
+
+type PipelineStep struct {
+	Name            string
+	Run             string
+	Dir             string
+	Env             map[string]string
+	ContinueOnError bool
+	Timeout         time.Duration
+	Parallel        []*PipelineStep
+}
+
+// Loads pipeline from file, if file does not exist nil is returned without error
+func loadPipeline(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parsePipeline(string(data))
+}
+
+// Parses pipeline from its YAML definition
+func parsePipeline(data string) (*Pipeline, error) {
+	doc, err := parseYaml(data)
+	if err != nil {
+		return nil, err
+	}
+	result := &Pipeline{}
+	if doc == nil {
+		return result, nil
+	}
+	root, err := yamlMap(doc, "pipeline")
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range root {
+		switch key {
+		case "env":
+			result.Env, err = yamlStringMap(value, key)
+		case "steps":
+			result.Steps, err = parsePipelineSteps(value)
+		case "matrix":
+			result.Matrix, err = parseMatrix(value)
+		case "container":
+			result.Container, err = parseContainer(value)
+		case "agent":
+			result.Agent, err = parseAgentLabels(value)
+		case "user", "inherit-env", "limits", "cgroup":
+			// Parsed as sandbox
+		default:
+			err = fmt.Errorf("unknown key '%s'", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.Sandbox, err = parseSandbox(root); err != nil {
+		return nil, err
+	}
+	if result.Container != nil && result.Sandbox.restricted() {
+		return nil, fmt.Errorf("user, limits and cgroup could not be combined with container")
+	}
+	return result, nil
+}
+
+// Gets sandbox of pipeline, that might not be defined
+func (p *Pipeline) GetSandbox() *Sandbox {
+	if p == nil {
+		return nil
+	}
+	return p.Sandbox
+}
+
+// Gets labels required from agent running the job, nil means job runs on lurch host
+func (p *Pipeline) GetAgent() []string {
+	if p == nil {
+		return nil
+	}
+	return p.Agent
+}
+
+func parseMatrix(value any) (map[string][]string, error) {
+	m, err := yamlMap(value, "matrix")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]string)
+	for key, values := range m {
+		if !matrixParamFormat.MatchString(key) {
+			return nil, fmt.Errorf("matrix parameter '%s' has incorrect format", key)
+		}
+		if v, ok := values.(string); ok {
+			result[key] = []string{v}
+			continue
+		}
+		items, err := yamlList(values, "matrix."+key)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			v, err := yamlString(item, "matrix."+key)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = append(result[key], v)
+		}
+		if len(result[key]) == 0 {
+			return nil, fmt.Errorf("matrix parameter '%s' has no values", key)
+		}
+	}
+	return result, nil
+}
+
+// Gets all combinations of matrix parameters, combinations are ordered by parameter names
+func (p *Pipeline) Combinations() []map[string]string {
+	if len(p.Matrix) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(p.Matrix))
+	for k := range p.Matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := []map[string]string{{}}
+	for _, k := range keys {
+		next := make([]map[string]string, 0, len(result)*len(p.Matrix[k]))
+		for _, combination := range result {
+			for _, v := range p.Matrix[k] {
+				c := maps.Clone(combination)
+				c[k] = v
+				next = append(next, c)
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+func parseContainer(value any) (*ContainerConfig, error) {
+	m, err := yamlMap(value, "container")
+	if err != nil {
+		return nil, err
+	}
+	result := &ContainerConfig{}
+	for key, value := range m {
+		switch key {
+		case "image":
+			result.Image, err = yamlString(value, "container.image")
+		case "cli":
+			result.Cli, err = yamlString(value, "container.cli")
+		case "options":
+			var items []any
+			if items, err = yamlList(value, "container.options"); err == nil {
+				for _, item := range items {
+					var option string
+					if option, err = yamlString(item, "container.options"); err != nil {
+						break
+					}
+					result.Options = append(result.Options, option)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown key '%s' in container", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.Image == "" {
+		return nil, fmt.Errorf("container has no image")
+	}
+	return result, nil
+}
+
+func parsePipelineSteps(value any) ([]*PipelineStep, error) {
+	items, err := yamlList(value, "steps")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*PipelineStep, len(items))
+	for i, item := range items {
+		if result[i], err = parsePipelineStep(item, fmt.Sprintf("steps[%d]", i), true); err != nil {
+			return nil, err
+		}
+		if result[i].Name == "" {
+			result[i].Name = fmt.Sprintf("step %d", i+1)
+		}
+	}
+	return result, nil
+}
+
+func parsePipelineStep(value any, name string, allowParallel bool) (*PipelineStep, error) {
+	if run, ok := value.(string); ok {
+		return &PipelineStep{Run: run}, nil
+	}
+	m, err := yamlMap(value, name)
+	if err != nil {
+		return nil, err
+	}
+	result := &PipelineStep{}
+	for key, value := range m {
+		switch key {
+		case "name":
+			result.Name, err = yamlString(value, name+".name")
+		case "run":
+			result.Run, err = yamlString(value, name+".run")
+		case "dir":
+			if result.Dir, err = yamlString(value, name+".dir"); err == nil && !filepath.IsLocal(filepath.FromSlash(result.Dir)) {
+				err = fmt.Errorf("'%s.dir' should be a relative path inside workspace", name)
+			}
+		case "env":
+			result.Env, err = yamlStringMap(value, name+".env")
+		case "continue-on-error":
+			result.ContinueOnError, err = yamlBool(value, name+"."+key)
+		case "timeout":
+			result.Timeout, err = yamlDuration(value, name+".timeout")
+		case "parallel":
+			if !allowParallel {
+				err = fmt.Errorf("%s could not be nested in parallel", name)
+			} else {
+				result.Parallel, err = parseParallelBranches(value, name+".parallel")
+			}
+		default:
+			err = fmt.Errorf("unknown key '%s' in %s", key, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Parallel) > 0 {
+		if result.Run != "" || result.Dir != "" || result.Env != nil || result.Timeout > 0 {
+			return nil, fmt.Errorf("%s could not combine parallel with run, dir, env or timeout", name)
+		}
+	} else if result.Run == "" {
+		return nil, fmt.Errorf("%s has nothing to run", name)
+	}
+	return result, nil
+}
+
+func parseParallelBranches(value any, name string) ([]*PipelineStep, error) {
+	items, err := yamlList(value, name)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*PipelineStep, len(items))
+	for i, item := range items {
+		if result[i], err = parsePipelineStep(item, fmt.Sprintf("%s[%d]", name, i), false); err != nil {
+			return nil, err
+		}
+		if result[i].Name == "" {
+			result[i].Name = fmt.Sprintf("branch %d", i+1)
+		}
+	}
+	return result, nil
+}
+
+// Runs steps of pipeline in sequence, each step is recorded as stage of job
+func (c *Context) runPipeline(b *Job, pipeline *Pipeline, e Executor, socket *socketServerContext) JobStatus {
+	for _, step := range pipeline.Steps {
+		if b.isStopped() {
+			return Stopped
+		}
+
+		b.stages.lineBreak()
+		fmt.Fprintf(b.stages, "::stage %s::\n", step.Name)
+		var status JobStatus
+		if len(step.Parallel) > 0 {
+			status = c.runParallel(b, pipeline, step, e, socket)
+		} else {
+			status = c.runTask(b, e, c.stepTask(b, pipeline, step, socket), b.stages, step.Timeout)
+		}
+		b.stages.lineBreak()
+		b.stages.End(status)
+
+		switch status {
+		case Stopped:
+			return Stopped
+		case Failed:
+			if !step.ContinueOnError {
+				return Failed
+			}
+			fmt.Fprintf(b.stages, "step '%s' failed, continuing\n", step.Name)
+		}
+	}
+	return Finished
+}
+
+// Runs branches of step concurrently, output of each branch is written into temporary file in job dir and appended
+// to job output as its own section, when the branch ends. Status of step is aggregated from statuses of all branches.
+func (c *Context) runParallel(b *Job, pipeline *Pipeline, step *PipelineStep, e Executor, socket *socketServerContext) JobStatus {
+	statuses := make([]JobStatus, len(step.Parallel))
+	wg := &sync.WaitGroup{}
+	for i, branch := range step.Parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			startDate := time.Now()
+			output, err := os.CreateTemp(b.dir, "branch-*.log")
+			if err != nil {
+				statuses[i] = Failed
+				b.stages.Append(&Stage{Name: branch.Name, Group: step.Name, Status: Failed, StartDate: startDate, EndDate: time.Now()}, strings.NewReader("could not create output of branch: "+err.Error()))
+				return
+			}
+			defer os.Remove(output.Name())
+			defer output.Close()
+
+			statuses[i] = c.runTask(b, e, c.stepTask(b, pipeline, branch, socket), output, branch.Timeout)
+			if statuses[i] == Failed && branch.ContinueOnError {
+				fmt.Fprintf(output, "\nbranch '%s' failed, continuing\n", branch.Name)
+			}
+			output.Seek(0, io.SeekStart)
+			b.stages.Append(&Stage{Name: branch.Name, Group: step.Name, Status: statuses[i], StartDate: startDate, EndDate: time.Now()}, output)
+		}()
+	}
+	wg.Wait()
+
+	result := Finished
+	for i, status := range statuses {
+		if status == Stopped {
+			return Stopped
+		} else if status == Failed && !step.Parallel[i].ContinueOnError {
+			result = Failed
+		}
+	}
+	return result
+}
+
+// Makes task of pipeline step
+func (c *Context) stepTask(b *Job, pipeline *Pipeline, step *PipelineStep, socket *socketServerContext) *Task {
+	t := &Task{Run: step.Run, Dir: step.Dir, Env: c.jobEnv(b, socket)}
+	for _, env := range []map[string]string{pipeline.Env, step.Env} {
+		for k, v := range env {
+			t.Env = append(t.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	return t
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePipeline(t *testing.T) {
+	p, err := parsePipeline(`env:
+  TARGET: dist
+steps:
+  - make build
+  - name: test
+    run: make test
+    dir: src
+    env:
+      VERBOSE: "1"
+    continue-on-error: true
+    timeout: 5m
+`)
+	if err != nil {
+		t.Fatal("TestParsePipeline: unexpected error", err)
+	}
+	if p.Env["TARGET"] != "dist" || len(p.Steps) != 2 {
+		t.Fatalf("TestParsePipeline: unexpected pipeline %v", p)
+	}
+	if s := p.Steps[0]; s.Name != "step 1" || s.Run != "make build" {
+		t.Fatalf("TestParsePipeline: unexpected first step %v", s)
+	}
+	if s := p.Steps[1]; s.Name != "test" || s.Dir != "src" || s.Env["VERBOSE"] != "1" || !s.ContinueOnError || s.Timeout != 5*time.Minute {
+		t.Fatalf("TestParsePipeline: unexpected second step %v", s)
+	}
+
+	for _, data := range []string{"steps:\n  - name: empty", "unknown: key", "steps:\n  - run: x\n    timeout: soon", "steps: make", "steps:\n  - run: x\n    dir: ../..", "steps:\n  - run: x\n    dir: /tmp", "steps:\n  - run: x\n    dir: src/../.."} {
+		if _, err := parsePipeline(data); err == nil {
+			t.Fatalf("TestParsePipeline: expected error for '%s'", data)
+		}
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("pipeline")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.PipelinePath(), []byte(`env:
+  GREETING: hello
+steps:
+  - name: prepare
+    run: |
+      mkdir sub
+      echo -n "$GREETING $NAME"
+    env:
+      NAME: lurch
+  - name: flaky
+    run: pwd; exit 1
+    dir: sub
+    continue-on-error: true
+  - name: slow
+    run: sleep 10
+    timeout: 1
+  - name: skipped
+    run: echo never
+`), 0644)
+
+	c.StartJob(p, nil, nil, nil)
+	time.Sleep(3 * time.Second)
+
+	j := c.OpenJob(p, "1")
+	if s := j.Status(); s != Failed {
+		t.Fatalf("TestRunPipeline: job ends with unexpected status %s", s.String())
+	}
+
+	expected := []JobStatus{Finished, Failed, Failed}
+	stages := j.Stages()
+	if len(stages) != len(expected) {
+		t.Fatalf("TestRunPipeline: unexpected count of stages %d", len(stages))
+	}
+	for i, s := range expected {
+		if stages[i].Status != s {
+			t.Fatalf("TestRunPipeline: stage '%s' has status %s instead of %s", stages[i].Name, stages[i].Status.String(), s.String())
+		}
+	}
+
+	output, _ := j.ReadOutput()
+	for _, s := range []string{"hello lurch\n::stage flaky::", filepath.Join("workspace", "sub"), "timeout 1s expired"} {
+		if !strings.Contains(output, s) {
+			t.Fatalf("TestRunPipeline: output does not contain '%s':\n%s", s, output)
+		}
+	}
+	if strings.Contains(output, "never") {
+		t.Fatalf("TestRunPipeline: skipped step should not run")
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("parallel")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.PipelinePath(), []byte(`steps:
+  - name: tests
+    parallel:
+      - name: slow
+        run: sleep 1; echo slow done
+      - name: broken
+        run: echo broken; exit 1
+      - name: optional
+        run: exit 2
+        continue-on-error: true
+  - name: skipped
+    run: echo never
+`), 0644)
+
+	if _, err := p.LoadPipeline(); err != nil {
+		t.Fatal("TestRunParallel: unexpected error", err)
+	}
+
+	// First job fails in the first group
+	c.StartJob(p, nil, nil, nil)
+	time.Sleep(2 * time.Second)
+
+	j := c.OpenJob(p, "1")
+	if s := j.Status(); s != Failed {
+		t.Fatalf("TestRunParallel: job ends with unexpected status %s", s.String())
+	}
+	stages := j.Stages()
+	if len(stages) != 4 || stages[0].Name != "tests" || stages[0].Status != Failed {
+		t.Fatalf("TestRunParallel: unexpected stages %v", stages)
+	}
+	statuses := map[string]JobStatus{}
+	for _, s := range stages[1:] {
+		if s.Group != "tests" {
+			t.Fatalf("TestRunParallel: stage '%s' has unexpected group '%s'", s.Name, s.Group)
+		}
+		statuses[s.Name] = s.Status
+	}
+	if statuses["slow"] != Finished || statuses["broken"] != Failed || statuses["optional"] != Failed {
+		t.Fatalf("TestRunParallel: unexpected statuses of branches %v", statuses)
+	}
+	if files, _ := filepath.Glob(filepath.Join(j.dir, "branch-*")); len(files) > 0 {
+		t.Fatalf("TestRunParallel: temporary output of branches should be removed %v", files)
+	}
+	output, _ := j.ReadOutput()
+	if !strings.Contains(output, "::stage slow::\nslow done\n") {
+		t.Fatalf("TestRunParallel: output of branch is not in its own section:\n%s", output)
+	}
+
+	// Second job runs only the waiting group and gets interrupted
+	os.WriteFile(p.PipelinePath(), []byte("steps:\n  - parallel:\n      - sleep 30\n      - sleep 30\n"), 0644)
+	c.StartJob(p, nil, nil, nil)
+	time.Sleep(500 * time.Millisecond)
+	j = c.OpenJob(p, "2")
+	c.Interrupt(j)
+	time.Sleep(2 * time.Second)
+	if c.IsBeingBuilt(j) {
+		t.Fatal("TestRunParallel: interrupted job should not be running")
+	}
+	if s := j.Status(); s != Stopped {
+		t.Fatalf("TestRunParallel: interrupted job has status %s", s.String())
+	}
+	for _, s := range j.Stages() {
+		if s.Status != Stopped {
+			t.Fatalf("TestRunParallel: stage '%s' has status %s instead of stopped", s.Name, s.Status.String())
+		}
+	}
+}
@@ -1,12 +1,27 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
+const pipelineFile = "lurch.yml"
+
+const scriptFile = "script.sh"
+
+// State of disabled project
+type ProjectDisabled struct {
+	Reason string    `json:"reason,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Date   time.Time `json:"date"`
+}
+
 type Project struct {
 	name   string
 	dir    string
@@ -37,11 +52,9 @@ func (p *Project) NewJob() (*Job, error) {
 	}
 	strJobNo := strconv.Itoa(jobNo)
 	b := &Job{name: strJobNo, dir: filepath.Join(p.dir, strJobNo), p: p}
-	if err := os.MkdirAll(b.dir, 0755); err != nil {
+	if err := b.init(); err != nil {
 		return nil, err
 	}
-	b.SetStatus(Unknown)
-	b.interrupt = make(chan bool)
 	return b, nil
 }
 
@@ -54,10 +67,64 @@ func (p *Project) SetParams(params map[string]string) {
 
 // Saves params into file
 func (p *Project) SaveParams() error {
-	return saveParams(filepath.Join(p.dir, "params"), p.params)
+	return saveParams(p.ParamsPath(), p.params)
 }
 
 // Loads params from file into map, if not found, leave method without drama
 func (p *Project) LoadParams() {
-	p.params = loadParams(filepath.Join(p.dir, "params"))
+	p.params = loadParams(p.ParamsPath())
+}
+
+// Path to default params of project
+func (p *Project) ParamsPath() string {
+	return filepath.Join(p.dir, "params")
+}
+
+// Path to pipeline definition
+func (p *Project) PipelinePath() string {
+	return filepath.Join(p.dir, pipelineFile)
+}
+
+// Loads pipeline definition, if project does not have any, nil is returned
+func (p *Project) LoadPipeline() (*Pipeline, error) {
+	return loadPipeline(p.PipelinePath())
+}
+
+// Path to build script, script.cmd is used on windows
+func (p *Project) ScriptPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(p.dir, "script.cmd")
+	}
+	return filepath.Join(p.dir, scriptFile)
+}
+
+// Path to state of disabled project
+func (p *Project) DisabledPath() string {
+	return filepath.Join(p.dir, "disabled")
+}
+
+// Gets state of disabled project, nil is returned if project is enabled
+func (p *Project) Disabled() *ProjectDisabled {
+	data, err := os.ReadFile(p.DisabledPath())
+	if err != nil {
+		return nil
+	}
+	result := &ProjectDisabled{}
+	json.Unmarshal(data, result)
+	return result
+}
+
+// Saves state of disabled project, project is enabled if state is nil
+func (p *Project) SetDisabled(state *ProjectDisabled) error {
+	if state == nil {
+		if err := os.Remove(p.DisabledPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.DisabledPath(), data, 0644)
 }
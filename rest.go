@@ -2,9 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 )
@@ -17,9 +21,11 @@ const (
 )
 
 type DomainProject struct {
-	Name   string            `json:"name"`
-	Jobs   []DomainJob       `json:"jobs"`
-	Params map[string]string `json:"params,omitempty"`
+	Name     string            `json:"name"`
+	Jobs     []DomainJob       `json:"jobs"`
+	Params   map[string]string `json:"params,omitempty"`
+	More     bool              `json:"more,omitempty"`
+	Disabled *ProjectDisabled  `json:"disabled,omitempty"`
 }
 
 type DomainJob struct {
@@ -31,11 +37,24 @@ type DomainJob struct {
 	Params       map[string]string `json:"params,omitempty"`
 	ArtifactSize float64           `json:"artifactSize,omitempty"`
 	ArtifactUnit MemoryUnit        `json:"artifactUnit"`
+	Stages       []Stage           `json:"stages,omitempty"`
+	Parent       string            `json:"parent,omitempty"`
+	Children     []DomainJob       `json:"children,omitempty"`
+	Meta         *JobMeta          `json:"meta,omitempty"`
+	Artifacts    []string          `json:"artifacts,omitempty"`
+	Cause        *JobCause         `json:"cause,omitempty"`
+}
+
+type DomainProjectChange struct {
+	Name   string `json:"name"`
+	Script string `json:"script,omitempty"`
+	Reason string `json:"reason,omitempty"`
 }
 
 type DomainStatus struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
+	Job     string `json:"job,omitempty"`
 }
 
 type MemoryUnit byte
@@ -84,7 +103,7 @@ func (s RestService) message(w http.ResponseWriter, message string, httpCode int
 func (s RestService) HandleFunc(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	params := s.parseUrl(r.URL.Path)
+	params := s.parseUrl(r.URL.EscapedPath())
 
 	switch params[ParamAction] {
 	case "projects":
@@ -100,6 +119,12 @@ func (s RestService) HandleFunc(w http.ResponseWriter, r *http.Request) {
 			if params[ParamParam] == "start" {
 				s.startJob(params[ParamProject], w, r)
 				return
+			} else if params[ParamParam] == "rerun" {
+				s.rerunJob(params[ParamProject], params[ParamParam2], w, r)
+				return
+			} else if params[ParamParam] == "meta" {
+				s.updateJobMeta(params[ParamProject], params[ParamParam2], w, r)
+				return
 			} else if params[ParamParam] == "interrupt" {
 				s.interruptJob(params[ParamProject], params[ParamParam2], w, r)
 				return
@@ -108,25 +133,53 @@ func (s RestService) HandleFunc(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
+	case "groups":
+		if params[ParamProject] == "" {
+			s.listGroups(w, r)
+			return
+		}
+	case "stats":
+		if params[ParamProject] != "" {
+			s.projectStats(params[ParamProject], w, r)
+			return
+		}
+	case "agents":
+		switch params[ParamProject] {
+		case "":
+			s.listAgents(w, r)
+			return
+		case "register":
+			s.registerAgent(w, r)
+			return
+		case "poll":
+			s.pollAgent(params[ParamParam], w, r)
+			return
+		case "output", "stages", "artifact", "finish":
+			s.updateAgentJob(params[ParamProject], params[ParamParam], w, r)
+			return
+		}
+	case "admin":
+		if params[ParamProject] == "drain" {
+			s.drain(w, r)
+			return
+		}
 	}
 	s.message(w, "", http.StatusNotFound)
 }
 
-func (s RestService) parseUrl(url string) map[string]string {
+// Parses escaped path of request, project in group is passed with escaped slash, e.g. backend%2Fapi
+func (s RestService) parseUrl(path string) map[string]string {
 	result := make(map[string]string)
 
-	urls := strings.Split(url, "/")
-	if len(urls) >= 3 {
-		result[ParamAction] = strings.TrimSpace(urls[2])
-	}
-	if len(urls) >= 4 {
-		result[ParamProject] = strings.TrimSpace(urls[3])
-	}
-	if len(urls) >= 5 {
-		result[ParamParam] = strings.TrimSpace(urls[4])
-	}
-	if len(urls) >= 6 {
-		result[ParamParam2] = strings.TrimSpace(urls[5])
+	urls := strings.Split(path, "/")
+	for i, key := range []string{ParamAction, ParamProject, ParamParam, ParamParam2} {
+		if len(urls) >= i+3 {
+			value, err := url.PathUnescape(urls[i+2])
+			if err != nil {
+				value = urls[i+2]
+			}
+			result[key] = strings.TrimSpace(value)
+		}
 	}
 
 	return result
@@ -144,35 +197,127 @@ func (s RestService) listProjects(w http.ResponseWriter, r *http.Request) {
 		s.message(w, "could not list projects", http.StatusInternalServerError)
 		return
 	}
-	result := make([]DomainProject, len(projects))
+	query := r.URL.Query()
+	group := query.Get("group")
+	query.Del("group")
+	filter, err := parseJobFilter(query)
+	if err != nil {
+		s.message(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result := make([]DomainProject, 0, len(projects))
 
-	for i, p := range projects {
+	for _, p := range projects {
+		if !p.InGroup(group) {
+			continue
+		}
 		jobs, err := s.c.ListJobs(p)
 		if err != nil {
 			s.message(w, "could not list jobs", http.StatusInternalServerError)
 			return
 		}
 		p.LoadParams()
-		result[i] = s.getProjectDetails(p, jobs)
+		result = append(result, s.getProjectDetails(p, jobs, filter))
 	}
 
 	e := json.NewEncoder(w)
 	e.Encode(result)
 }
 
-// Get project details and history of jobs
-func (s RestService) getProjectDetails(p *Project, jobs []*Job) DomainProject {
-	project := DomainProject{Name: p.name, Jobs: make([]DomainJob, len(jobs)), Params: p.params}
+// List groups of projects with their aggregated status
+func (s RestService) listGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groups, err := s.c.ListGroups()
+	if err != nil {
+		s.message(w, "could not list groups", http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	e.Encode(groups)
+}
+
+// Get project details and history of jobs matching filter
+func (s RestService) getProjectDetails(p *Project, jobs []*Job, filter *jobFilter) DomainProject {
+	status := cachedStatus(s.jobStatus)
+	jobs, more := filter.apply(jobs, status)
+	project := DomainProject{Name: p.name, Jobs: make([]DomainJob, len(jobs)), Params: p.params, More: more, Disabled: p.Disabled()}
 	for j, b := range jobs {
-		status := b.Status()
-		if s.c.IsBeingBuilt(b) {
-			status = InProgress
-		}
-		project.Jobs[j] = DomainJob{Name: b.name, Status: status, StartDate: b.StartDate(), EndDate: b.EndDate()}
+		project.Jobs[j] = DomainJob{Name: b.name, Status: status(b), StartDate: b.StartDate(), EndDate: b.EndDate(), Meta: b.Meta()}
 	}
 	return project
 }
 
+// Gets status of job, running job is always in progress
+func (s RestService) jobStatus(b *Job) JobStatus {
+	if s.c.IsBeingBuilt(b) {
+		return InProgress
+	}
+	return b.Status()
+}
+
+// Opens existing project, nil is returned if it does not exist
+func (s RestService) openProject(projectName string) *Project {
+	p := s.c.OpenProject(projectName)
+	if p == nil {
+		return nil
+	}
+	if !p.Exists() {
+		return nil
+	}
+	return p
+}
+
+// Opens existing job of existing project, nil is returned if it does not exist
+func (s RestService) openJob(projectName, jobNumber string) *Job {
+	p := s.openProject(projectName)
+	if p == nil || !isNumber(strings.Replace(jobNumber, ".", "", 1)) || strings.HasPrefix(jobNumber, ".") || strings.HasSuffix(jobNumber, ".") {
+		return nil
+	}
+	b := s.c.OpenJob(p, jobNumber)
+	if stat, err := os.Stat(b.dir); err != nil || !stat.IsDir() {
+		return nil
+	}
+	return b
+}
+
+// Decodes JSON body of request, empty body is accepted
+func (s RestService) decodeBody(r *http.Request, result any) error {
+	if err := json.NewDecoder(r.Body).Decode(result); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// Writes response to enqueued job, API responds with location of created job
+func (s RestService) enqueued(w http.ResponseWriter, r *http.Request, p *Project, buildNo string) {
+	code := http.StatusOK
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		code = http.StatusCreated
+		w.Header().Set("location", fmt.Sprintf("%s/projects/%s/jobs/%s", apiPrefix, url.PathEscape(p.name), buildNo))
+	}
+	w.WriteHeader(code)
+	e := json.NewEncoder(w)
+	e.Encode(&DomainStatus{Message: fmt.Sprintf("job #%s enqueued", buildNo), Code: code, Job: buildNo})
+}
+
+// Writes response to job, that could not be enqueued
+func (s RestService) notEnqueued(w http.ResponseWriter, p *Project) {
+	if s.c.IsDraining() {
+		s.message(w, "lurch is draining, no jobs are accepted", http.StatusServiceUnavailable)
+	} else if disabled := p.Disabled(); disabled != nil {
+		s.message(w, strings.TrimSuffix("project is disabled: "+disabled.Reason, ": "), http.StatusConflict)
+	} else if s.c.isProjectBeingBuilt(p) {
+		s.message(w, "project is already being built", http.StatusConflict)
+	} else {
+		s.message(w, "job could not be enqueued", http.StatusInternalServerError)
+	}
+}
+
 // List project details
 func (s RestService) listProject(projectName string, w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -180,9 +325,14 @@ func (s RestService) listProject(projectName string, w http.ResponseWriter, r *h
 		return
 	}
 
-	p := s.c.OpenProject(projectName)
+	p := s.openProject(projectName)
 	if p == nil {
-		s.message(w, "could not list jobs", http.StatusInternalServerError)
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+	filter, err := parseJobFilter(r.URL.Query())
+	if err != nil {
+		s.message(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	p.LoadParams()
@@ -193,7 +343,202 @@ func (s RestService) listProject(projectName string, w http.ResponseWriter, r *h
 	}
 
 	e := json.NewEncoder(w)
-	e.Encode(s.getProjectDetails(p, jobs))
+	e.Encode(s.getProjectDetails(p, jobs, filter))
+}
+
+// Gets aggregated statistics of project
+func (s RestService) projectStats(projectName string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	e.Encode(aggregateStats(s.c.loadStats(p, nil)))
+}
+
+// Maximal size of build script accepted through API
+const maxScriptSize = 1 << 20
+
+// Writes response to failed change of project
+func (s RestService) projectChangeFailed(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidName), errors.Is(err, errInvalidSettings):
+		s.message(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errProjectNotFound):
+		s.message(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errProjectExists), errors.Is(err, errProjectBuilding):
+		s.message(w, err.Error(), http.StatusConflict)
+	default:
+		log.Print("could not change project: ", err)
+		s.message(w, "could not change project", http.StatusInternalServerError)
+	}
+}
+
+// Writes response to created project with its location
+func (s RestService) projectCreated(w http.ResponseWriter, p *Project) {
+	w.Header().Set("location", fmt.Sprintf("%s/projects/%s", apiPrefix, url.PathEscape(p.name)))
+	s.message(w, fmt.Sprintf("project %s created", p.name), http.StatusCreated)
+}
+
+// Creates new project with build script
+func (s RestService) createProject(w http.ResponseWriter, r *http.Request) {
+	var t DomainProjectChange
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScriptSize)).Decode(&t); err != nil {
+		s.message(w, "invalid body of request", http.StatusBadRequest)
+		return
+	}
+
+	p, err := s.c.CreateProject(t.Name, t.Script)
+	if err != nil {
+		s.projectChangeFailed(w, err)
+		return
+	}
+	s.projectCreated(w, p)
+}
+
+// Renames or copies project to name in body
+func (s RestService) moveProject(projectName, action string, w http.ResponseWriter, r *http.Request) {
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+
+	var t DomainProjectChange
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		s.message(w, "invalid body of request", http.StatusBadRequest)
+		return
+	}
+
+	if action == "copy" {
+		result, err := s.c.CopyProject(p, t.Name)
+		if err != nil {
+			s.projectChangeFailed(w, err)
+			return
+		}
+		s.projectCreated(w, result)
+		return
+	}
+
+	result, err := s.c.RenameProject(p, t.Name)
+	if err != nil {
+		s.projectChangeFailed(w, err)
+		return
+	}
+	w.Header().Set("location", fmt.Sprintf("%s/projects/%s", apiPrefix, url.PathEscape(result.name)))
+	s.message(w, fmt.Sprintf("project %s renamed to %s", p.name, result.name), http.StatusOK)
+}
+
+// Disables project with reason in body or enables it
+func (s RestService) toggleProject(projectName string, enable bool, w http.ResponseWriter, r *http.Request) {
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+
+	if enable {
+		if err := s.c.EnableProject(p); err != nil {
+			s.projectChangeFailed(w, err)
+			return
+		}
+		s.message(w, fmt.Sprintf("project %s enabled", p.name), http.StatusOK)
+		return
+	}
+
+	var t DomainProjectChange
+	if err := s.decodeBody(r, &t); err != nil {
+		s.message(w, "invalid body of request", http.StatusBadRequest)
+		return
+	}
+	if err := s.c.DisableProject(p, t.Reason, s.c.Authorize(r)); err != nil {
+		s.projectChangeFailed(w, err)
+		return
+	}
+	s.message(w, fmt.Sprintf("project %s disabled", p.name), http.StatusOK)
+}
+
+// Deletes project including its history
+func (s RestService) deleteProject(projectName string, w http.ResponseWriter, r *http.Request) {
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+	if err := s.c.DeleteProject(p); err != nil {
+		s.projectChangeFailed(w, err)
+		return
+	}
+	s.message(w, fmt.Sprintf("project %s deleted", p.name), http.StatusOK)
+}
+
+// Gets or updates build script of project
+func (s RestService) projectScript(projectName string, w http.ResponseWriter, r *http.Request) {
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxScriptSize))
+		if err != nil {
+			s.message(w, "script is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := p.SaveScript(string(data)); err != nil {
+			s.projectChangeFailed(w, err)
+			return
+		}
+		s.c.publishProject(changeEdited, p.name, "")
+		s.message(w, "script saved", http.StatusOK)
+		return
+	}
+
+	script, err := p.ReadScript()
+	if err != nil {
+		s.projectChangeFailed(w, err)
+		return
+	}
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	w.Write([]byte(script))
+}
+
+// Gets or updates settings of project
+func (s RestService) projectSettings(projectName string, w http.ResponseWriter, r *http.Request) {
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var t ProjectSettings
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScriptSize)).Decode(&t); err != nil {
+			s.message(w, "invalid body of request", http.StatusBadRequest)
+			return
+		}
+		if err := p.SaveSettings(&t); err != nil {
+			s.projectChangeFailed(w, err)
+			return
+		}
+		s.c.publishProject(changeEdited, p.name, "")
+	}
+
+	settings, err := p.LoadSettings()
+	if err != nil {
+		s.projectChangeFailed(w, err)
+		return
+	}
+	e := json.NewEncoder(w)
+	e.Encode(settings)
 }
 
 // Start new job
@@ -203,26 +548,105 @@ func (s RestService) startJob(projectName string, w http.ResponseWriter, r *http
 		return
 	}
 
+	if s.c.IsDraining() {
+		s.message(w, "lurch is draining, no jobs are accepted", http.StatusServiceUnavailable)
+		return
+	}
+
+	p := s.openProject(projectName)
+	if p == nil {
+		s.message(w, "project not found", http.StatusNotFound)
+		return
+	}
+
 	var t DomainJob
-	decoder := json.NewDecoder(r.Body)
-	decoder.Decode(&t)
+	if err := s.decodeBody(r, &t); err != nil {
+		s.message(w, "invalid body of request", http.StatusBadRequest)
+		return
+	}
+
+	if err := t.Meta.Validate(); err != nil {
+		s.message(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if buildNo := s.c.StartJob(s.c.OpenProject(projectName), t.Params); buildNo != "" {
-		s.message(w, fmt.Sprintf("job #%s enqueued", buildNo), http.StatusOK)
+	if buildNo := s.c.StartJob(p, t.Params, s.c.requestCause(r, t.Cause), t.Meta); buildNo != "" {
+		s.enqueued(w, r, p, buildNo)
 	} else {
-		s.message(w, "job could not be enqueued", http.StatusBadRequest)
+		s.notEnqueued(w, p)
 	}
 }
 
+// Start new job with params of existing job, params in body override the original ones
+func (s RestService) rerunJob(projectName, jobNumber string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.c.IsDraining() {
+		s.message(w, "lurch is draining, no jobs are accepted", http.StatusServiceUnavailable)
+		return
+	}
+
+	b := s.openJob(projectName, jobNumber)
+	if b == nil {
+		s.message(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	var t DomainJob
+	if err := s.decodeBody(r, &t); err != nil {
+		s.message(w, "invalid body of request", http.StatusBadRequest)
+		return
+	}
+
+	if buildNo := s.c.RerunJob(b, t.Params, s.c.requestCause(r, t.Cause)); buildNo != "" {
+		s.enqueued(w, r, b.p, buildNo)
+	} else {
+		s.notEnqueued(w, b.p)
+	}
+}
+
+// Merges metadata of job with metadata in body
+func (s RestService) updateJobMeta(projectName, jobNumber string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPatch {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b := s.openJob(projectName, jobNumber)
+	if b == nil {
+		s.message(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	var t JobMeta
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		s.message(w, "invalid metadata", http.StatusBadRequest)
+		return
+	}
+	if err := b.UpdateMeta(&t); err != nil {
+		s.message(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.c.broadcastUpdate(b)
+
+	e := json.NewEncoder(w)
+	e.Encode(b.Meta())
+}
+
+// Interrupts running job
 func (s RestService) interruptJob(projectName, jobNumber string, w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.message(w, "", http.StatusMethodNotAllowed)
 		return
 	}
 
-	b := s.c.OpenJob(s.c.OpenProject(projectName), jobNumber)
+	b := s.openJob(projectName, jobNumber)
 	if b == nil {
-		s.message(w, "job could not be interrupted", http.StatusBadRequest)
+		s.message(w, "job not found", http.StatusNotFound)
+		return
 	}
 	s.c.Interrupt(b)
 
@@ -231,30 +655,189 @@ func (s RestService) interruptJob(projectName, jobNumber string, w http.Response
 
 // Gets details of project's job
 func (s RestService) jobDetail(projectName, jobNumber string, w http.ResponseWriter, r *http.Request) {
-	if jobNumber == "" {
-		s.message(w, "", http.StatusNotFound)
+	if r.Method != http.MethodGet {
+		s.message(w, "", http.StatusMethodNotAllowed)
 		return
 	}
 
-	b := s.c.OpenJob(s.c.OpenProject(projectName), jobNumber)
+	b := s.openJob(projectName, jobNumber)
 	if b == nil {
-		s.message(w, "could not get job detail", http.StatusBadRequest)
+		s.message(w, "job not found", http.StatusNotFound)
 		return
 	}
 
-	status := b.Status()
+	status := s.jobStatus(b)
 	artifactSize := float64(-1)
 	artifactUnit := UnitB
-	if s.c.IsBeingBuilt(b) {
-		status = InProgress
-	} else {
+	if status != InProgress {
 		artifactSize, artifactUnit = tidyUnit(b.ArtifactSize(), 0)
 	}
 
 	output, _ := b.ReadOutput()
 
+	result := DomainJob{Name: b.name, Status: status, StartDate: b.StartDate(), EndDate: b.EndDate(), Output: output, ArtifactSize: artifactSize, ArtifactUnit: artifactUnit, Stages: b.Stages(), Meta: b.Meta(), Artifacts: b.Artifacts(), Cause: b.Cause()}
+	if b.parent != nil {
+		result.Parent = b.parent.name
+	}
+	for _, child := range b.Children() {
+		child.LoadParams()
+		result.Children = append(result.Children, DomainJob{Name: child.name, Status: s.jobStatus(child), StartDate: child.StartDate(), EndDate: child.EndDate(), Params: child.params})
+	}
+
+	e := json.NewEncoder(w)
+	e.Encode(result)
+}
+
+// Stops accepting new jobs, lets running ones finish and stops lurch
+func (s RestService) drain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.c.Authorize(r) == "" {
+		s.message(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	if s.c.IsDraining() {
+		s.message(w, "lurch is already draining", http.StatusOK)
+		return
+	}
+
+	s.c.Stop()
+	s.message(w, "lurch is draining", http.StatusAccepted)
+}
+
+// List connected agents
+func (s RestService) listAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.c.Authorize(r) == "" {
+		s.message(w, "", http.StatusUnauthorized)
+		return
+	}
+
 	e := json.NewEncoder(w)
-	e.Encode(DomainJob{Name: b.name, Status: status, StartDate: b.StartDate(), EndDate: b.EndDate(), Output: output, ArtifactSize: artifactSize, ArtifactUnit: artifactUnit})
+	e.Encode(s.c.agents.List())
+}
+
+// Register new agent with its labels
+func (s RestService) registerAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.c.Authorize(r) == "" {
+		s.message(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var a Agent
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil || a.Name == "" {
+		s.message(w, "agent could not be registered", http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	e.Encode(s.c.agents.Register(a.Name, a.Labels))
+}
+
+// Wait for job matching labels of agent
+func (s RestService) pollAgent(id string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.c.Authorize(r) == "" {
+		s.message(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	assignment, err := s.c.agents.Poll(r.Context(), id)
+	if err != nil {
+		s.message(w, err.Error(), http.StatusNotFound)
+		return
+	} else if assignment == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	e.Encode(assignment)
+}
+
+// Receive output, stages, artifact or final status of job running on agent
+func (s RestService) updateAgentJob(action, id string, w http.ResponseWriter, r *http.Request) {
+	if (action == "artifact" && r.Method != http.MethodPut) || (action != "artifact" && r.Method != http.MethodPost) {
+		s.message(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.c.Authorize(r) == "" {
+		s.message(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	j := s.c.agents.Job(id)
+	if j == nil {
+		s.message(w, "job is not assigned", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "output":
+		if _, err := io.Copy(j.b.stages, r.Body); err != nil {
+			s.message(w, "could not write output", http.StatusInternalServerError)
+			return
+		}
+		if j.b.isStopped() {
+			s.message(w, "job was stopped", http.StatusGone)
+			return
+		}
+	case "stages":
+		var stages []*Stage
+		if err := json.NewDecoder(r.Body).Decode(&stages); err != nil {
+			s.message(w, "invalid stages", http.StatusBadRequest)
+			return
+		}
+		j.b.stages.Report(stages)
+	case "artifact":
+		path := j.b.ArtifactPath()
+		if name := r.URL.Query().Get("name"); name != "" {
+			if path = j.b.NamedArtifactPath(name); path == "" {
+				s.message(w, "invalid artifact name", http.StatusBadRequest)
+				return
+			}
+			os.MkdirAll(j.b.ArtifactsDir(), 0755)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			s.message(w, "could not save artifact", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, r.Body); err != nil {
+			s.message(w, "could not save artifact", http.StatusInternalServerError)
+			return
+		}
+	case "finish":
+		var t DomainJob
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			s.message(w, "unknown status", http.StatusBadRequest)
+			return
+		}
+		if t.Meta != nil {
+			j.b.UpdateMeta(t.Meta)
+		}
+		s.c.agents.Finish(j, t.Status)
+	}
+	s.message(w, "", http.StatusOK)
 }
 
 func tidyUnit(value int64, start byte) (float64, MemoryUnit) {
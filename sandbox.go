@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Argument of lurch making it a helper, that applies resource limits and executes the command
+const sandboxExecArg = "--sandbox-exec"
+
+// Options restricting jobs executed on host
+type Sandbox struct {
+	User       string
+	InheritEnv bool
+	Whitelist  []string
+	Limits     map[string]uint64
+	Cgroup     string
+}
+
+// Parses sandbox options from pipeline definition
+func parseSandbox(root map[string]any) (*Sandbox, error) {
+	result := &Sandbox{InheritEnv: true}
+	var err error
+	if value, ok := root["user"]; ok {
+		if result.User, err = yamlString(value, "user"); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := root["inherit-env"]; ok {
+		if items, isList := value.([]any); isList {
+			result.InheritEnv = false
+			result.Whitelist = make([]string, 0)
+			for _, item := range items {
+				name, err := yamlString(item, "inherit-env")
+				if err != nil {
+					return nil, err
+				}
+				result.Whitelist = append(result.Whitelist, name)
+			}
+		} else if result.InheritEnv, err = yamlBool(value, "inherit-env"); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := root["limits"]; ok {
+		if result.Limits, err = parseLimits(value); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := root["cgroup"]; ok {
+		if result.Cgroup, err = yamlString(value, "cgroup"); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func parseLimits(value any) (map[string]uint64, error) {
+	m, err := yamlStringMap(value, "limits")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]uint64)
+	for key, v := range m {
+		switch key {
+		case "cpu", "files", "processes":
+			result[key], err = strconv.ParseUint(v, 10, 64)
+		case "memory":
+			result[key], err = parseMemory(v)
+		default:
+			return nil, fmt.Errorf("unknown limit '%s'", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("limit '%s' has incorrect value '%s'", key, v)
+		}
+	}
+	return result, nil
+}
+
+// Parses amount of memory with optional K, M, G or T suffix
+func parseMemory(value string) (uint64, error) {
+	multiplier := uint64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(strings.ToUpper(value), unit) {
+			value = value[:len(value)-1]
+			multiplier = 1 << (10 * (i + 1))
+			break
+		}
+	}
+	result, err := strconv.ParseUint(value, 10, 64)
+	return result * multiplier, err
+}
+
+// Checks if sandbox restricts anything
+func (s *Sandbox) restricted() bool {
+	return s != nil && (s.User != "" || len(s.Limits) > 0 || s.Cgroup != "")
+}
+
+// Gets environment of lurch, that is inherited by job
+func (s *Sandbox) environ() []string {
+	if s == nil || s.InheritEnv {
+		return os.Environ()
+	}
+	result := make([]string, 0)
+	for _, name := range s.Whitelist {
+		if value, ok := os.LookupEnv(name); ok {
+			result = append(result, name+"="+value)
+		}
+	}
+	return result
+}
+
+// Formats resource limits as argument of sandbox helper
+func (s *Sandbox) limitsArg() string {
+	result := make([]string, 0, len(s.Limits))
+	for k, v := range s.Limits {
+		result = append(result, fmt.Sprintf("%s=%d", k, v))
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
@@ -0,0 +1,16 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import "syscall"
+
+// Limit of processes of user, syscall does not export RLIMIT_NPROC on BSD
+const rlimitNproc = 7
+
+// Memory is limited by data segment, because address space limit is not available on every BSD
+var rlimitResources = map[string]int{
+	"cpu":       syscall.RLIMIT_CPU,
+	"memory":    syscall.RLIMIT_DATA,
+	"files":     syscall.RLIMIT_NOFILE,
+	"processes": rlimitNproc,
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Limit of processes of user, syscall does not export RLIMIT_NPROC on linux
+const rlimitNproc = 6
+
+var rlimitResources = map[string]int{
+	"cpu":       syscall.RLIMIT_CPU,
+	"memory":    syscall.RLIMIT_AS,
+	"files":     syscall.RLIMIT_NOFILE,
+	"processes": rlimitNproc,
+}
+
+// Creates cgroup v2 sub-tree for command with memory and process limits and starts command in it
+func joinCgroup(cmd *exec.Cmd, s *Sandbox, b *Job) (func(), error) {
+	dir := filepath.Join(s.Cgroup, containerNameFormat.ReplaceAllString("lurch-"+b.p.name+"-"+b.name+"-"+randomToken(6), "-"))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	release := func() {
+		os.Remove(dir)
+	}
+
+	for limit, file := range map[string]string{"memory": "memory.max", "processes": "pids.max"} {
+		if value, ok := s.Limits[limit]; ok {
+			if err := os.WriteFile(filepath.Join(dir, file), []byte(strconv.FormatUint(value, 10)), 0644); err != nil {
+				release()
+				return nil, err
+			}
+		}
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+
+	return func() {
+		f.Close()
+		release()
+	}, nil
+}
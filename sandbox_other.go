@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func joinCgroup(cmd *exec.Cmd, s *Sandbox, b *Job) (func(), error) {
+	return nil, errors.New("cgroups are supported only on linux")
+}
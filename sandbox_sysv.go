@@ -0,0 +1,12 @@
+//go:build aix || solaris
+
+package main
+
+import "syscall"
+
+// Limit of processes is not available
+var rlimitResources = map[string]int{
+	"cpu":    syscall.RLIMIT_CPU,
+	"memory": syscall.RLIMIT_AS,
+	"files":  syscall.RLIMIT_NOFILE,
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSandbox(t *testing.T) {
+	p, err := parsePipeline("user: nobody:nogroup\ninherit-env: [PATH, HOME]\nlimits:\n  cpu: 60\n  memory: 2G\n  files: 128\n  processes: 64\n")
+	if err != nil {
+		t.Fatal("TestParseSandbox: unexpected error", err)
+	}
+	s := p.Sandbox
+	if s.User != "nobody:nogroup" || s.InheritEnv || len(s.Whitelist) != 2 || !s.restricted() {
+		t.Fatalf("TestParseSandbox: unexpected sandbox %v", s)
+	}
+	if s.limitsArg() != "cpu=60,files=128,memory=2147483648,processes=64" {
+		t.Fatalf("TestParseSandbox: unexpected limits '%s'", s.limitsArg())
+	}
+
+	if p, _ := parsePipeline("inherit-env: false"); p.Sandbox.InheritEnv || p.Sandbox.restricted() || len(p.Sandbox.environ()) != 0 {
+		t.Fatalf("TestParseSandbox: environment should be cleared")
+	}
+
+	for _, data := range []string{"limits:\n  disk: 1", "limits:\n  memory: lots", "user: nobody\ncontainer:\n  image: alpine"} {
+		if _, err := parsePipeline(data); err == nil {
+			t.Fatalf("TestParseSandbox: expected error for '%s'", data)
+		}
+	}
+}
+
+func TestRunInSandbox(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	os.Chmod(tmpdir, 0755)
+
+	t.Setenv("LURCH_TEST_VISIBLE", "visible")
+	t.Setenv("LURCH_TEST_HIDDEN", "hidden")
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	run := func(name, definition string, expected ...string) {
+		p := c.OpenProject(name)
+		if err = os.MkdirAll(p.dir, 0755); err != nil {
+			panic(err)
+		}
+		os.WriteFile(p.PipelinePath(), []byte(definition), 0644)
+
+		c.StartJob(p, nil, nil, nil)
+		time.Sleep(time.Second)
+
+		j := c.OpenJob(p, "1")
+		output, _ := j.ReadOutput()
+		if s := j.Status(); s != Finished {
+			t.Fatalf("TestRunInSandbox: job of %s has status %s instead of finished:\n%s", name, s.String(), output)
+		}
+		for _, e := range expected {
+			if !strings.Contains(output, e) {
+				t.Fatalf("TestRunInSandbox: output of %s does not contain '%s':\n%s", name, e, output)
+			}
+		}
+	}
+
+	run("env", "inherit-env: [PATH, LURCH_TEST_VISIBLE]\nsteps:\n  - run: echo \"env:$LURCH_TEST_VISIBLE:$LURCH_TEST_HIDDEN\"\n", "env:visible:\n")
+	run("limits", "limits:\n  files: 64\nsteps:\n  - run: echo \"files:$(ulimit -n)\"\n", "files:64\n")
+	if os.Getuid() == 0 {
+		run("user", "user: nobody\nsteps:\n  - run: echo \"uid:$(id -u)\"; touch created\n", "uid:65534\n")
+	}
+}
@@ -0,0 +1,132 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Applies sandbox on command, returned function releases resources allocated for the command
+func (s *Sandbox) apply(cmd *exec.Cmd, b *Job) (func(), error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if !s.restricted() {
+		return func() {}, nil
+	}
+
+	if s.User != "" {
+		uid, gid, err := lookupUser(s.User)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chown(cmd.Dir, int(uid), int(gid)); err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid}
+	}
+
+	if len(s.Limits) > 0 {
+		self, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Args = append([]string{self, sandboxExecArg, s.limitsArg(), "--"}, cmd.Args...)
+		cmd.Path = self
+	}
+
+	if s.Cgroup != "" {
+		return joinCgroup(cmd, s, b)
+	}
+	return func() {}, nil
+}
+
+// Looks up user and group in format user[:group], both could be names or numeric ids
+func lookupUser(value string) (uint32, uint32, error) {
+	userName, groupName, _ := strings.Cut(value, ":")
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			if _, convErr := strconv.ParseUint(userName, 10, 32); convErr != nil {
+				return 0, 0, fmt.Errorf("unknown user '%s'", userName)
+			}
+			u = &user.User{Uid: userName, Gid: userName}
+		}
+	}
+	gid := u.Gid
+	if groupName != "" {
+		if g, err := user.LookupGroup(groupName); err == nil {
+			gid = g.Gid
+		} else if g, err := user.LookupGroupId(groupName); err == nil {
+			gid = g.Gid
+		} else {
+			gid = groupName
+		}
+	}
+
+	uidValue, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unsupported uid '%s'", u.Uid)
+	}
+	gidValue, err := strconv.ParseUint(gid, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unknown group '%s'", gid)
+	}
+	return uint32(uidValue), uint32(gidValue), nil
+}
+
+// Kills whole process group of command
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err == nil {
+			return nil
+		}
+	}
+	return cmd.Process.Kill()
+}
+
+// Sets resource limits of lurch and replaces it with the command, it is used as a helper of sandbox
+func sandboxExec(args []string) int {
+	if len(args) < 3 || args[1] != "--" {
+		fmt.Fprintln(os.Stderr, "lurch: wrong arguments of sandbox")
+		return 1
+	}
+	for _, limit := range strings.Split(args[0], ",") {
+		name, value, _ := strings.Cut(limit, "=")
+		resource, ok := rlimitResources[name]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, 63)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lurch: wrong limit '%s'\n", limit)
+			return 1
+		}
+		rlimit := &syscall.Rlimit{}
+		setRlimitValue(&rlimit.Cur, v)
+		setRlimitValue(&rlimit.Max, v)
+		if err := syscall.Setrlimit(resource, rlimit); err != nil {
+			fmt.Fprintf(os.Stderr, "lurch: could not set limit '%s': %s\n", limit, err)
+			return 1
+		}
+	}
+
+	path, err := exec.LookPath(args[2])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lurch:", err)
+		return 1
+	}
+	err = syscall.Exec(path, args[2:], os.Environ())
+	fmt.Fprintln(os.Stderr, "lurch:", err)
+	return 1
+}
+
+// Sets value of resource limit, that is signed on some systems
+func setRlimitValue[T int64 | uint64](field *T, value uint64) {
+	*field = T(value)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func (s *Sandbox) apply(cmd *exec.Cmd, b *Job) (func(), error) {
+	if s.restricted() {
+		return nil, errors.New("user, limits and cgroup are not supported on windows")
+	}
+	return func() {}, nil
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func sandboxExec(args []string) int {
+	return 1
+}
@@ -2,27 +2,48 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type socketAction byte
-type socketResponse byte
 
 const (
 	socketActionStart socketAction = iota + 1
+	socketActionStage
+	socketActionProgress
+	socketActionMeta
+	socketActionArtifact
+	socketActionStatus
 )
 
 const (
-	socketResponseOk socketResponse = iota
-	socketResponseFail
+	envSocketPort  = "LURCH_SOCKET_PORT"
+	envSocketToken = "LURCH_SOCKET_TOKEN"
 )
 
 const (
-	envSocketPort  = "LURCH_SOCKET_PORT"
-	envSocketToken = "LURCH_SOCKET_TOKEN"
+	socketProtocolVersion = 1
+	socketMaxLength       = 1 << 20
+)
+
+// Exit codes of client, job statuses are reflected by their own codes
+const (
+	exitCodeOk         = 0
+	exitCodeFail       = 1
+	exitCodeFailed     = 2
+	exitCodeStopped    = 3
+	exitCodeUnknown    = 4
+	exitCodeInProgress = 5
 )
 
 type socketServerContext struct {
@@ -33,26 +54,61 @@ type socketServerContext struct {
 	token string
 }
 
-type socketData struct {
-	token  string
-	action socketAction
-	length int
-	data   string
+// Request sent by build script to lurch
+type socketRequest struct {
+	Token  string            `json:"token"`
+	Action socketAction      `json:"action"`
+	Data   string            `json:"data,omitempty"`
+	Value  string            `json:"value,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	Wait   bool              `json:"wait,omitempty"`
+	Output bool              `json:"output,omitempty"`
 }
 
-func (s *socketServerContext) parseSocketData(str string) *socketData {
-	result := &socketData{}
-	_, err := fmt.Sscanf(str, "%s %d %d %s", &result.token, &result.action, &result.length, &result.data)
+// Response of lurch to build script
+type socketResponse struct {
+	Ok      bool      `json:"ok"`
+	Message string    `json:"message,omitempty"`
+	Job     string    `json:"job,omitempty"`
+	Status  JobStatus `json:"status"`
+	Output  string    `json:"output,omitempty"`
+	Partial bool      `json:"partial,omitempty"`
+}
 
-	if err != nil || len(result.data) != result.length || s.token != result.token {
-		return nil
+// Writes message as JSON framed by header with protocol version and length of message
+func writeSocketMessage(w io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "lurch/%d %d\n", socketProtocolVersion, len(data)); err != nil {
+		return err
 	}
-	return result
+	_, err = w.Write(data)
+	return err
 }
 
-func (s *socketData) String() string {
-	s.length = len(s.data)
-	return fmt.Sprintf("%s %d %d %s", s.token, s.action, s.length, s.data)
+// Reads message framed by header with protocol version and length of message
+func readSocketMessage(r *bufio.Reader, message any) error {
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	var version, length int
+	if _, err := fmt.Sscanf(header, "lurch/%d %d\n", &version, &length); err != nil {
+		return errors.New("invalid header of message")
+	}
+	if version != socketProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", version)
+	}
+	if length < 0 || length > socketMaxLength {
+		return fmt.Errorf("invalid length of message %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, message)
 }
 
 func startServerSocket(c *Context, j *Job) *socketServerContext {
@@ -79,58 +135,211 @@ func (s *socketServerContext) handle() {
 		if err != nil {
 			break
 		}
+		go s.handleConnection(con)
+	}
+}
 
-		msg, err := bufio.NewReader(con).ReadString('\n')
-		if err != nil {
-			break
+func (s *socketServerContext) handleConnection(con net.Conn) {
+	defer con.Close()
+
+	var req socketRequest
+	if err := readSocketMessage(bufio.NewReader(con), &req); err != nil {
+		log.Print("incomming data are not valid: ", err)
+		writeSocketMessage(con, &socketResponse{Message: err.Error()})
+		return
+	}
+	if req.Token != s.token {
+		log.Print("incomming data are not valid: wrong token")
+		writeSocketMessage(con, &socketResponse{Message: "wrong token"})
+		return
+	}
+	writeSocketMessage(con, s.perform(&req, con))
+}
+
+// Performs action of request, partial responses could be written into connection before the final one
+func (s *socketServerContext) perform(req *socketRequest, con io.Writer) *socketResponse {
+	switch req.Action {
+	case socketActionStart:
+		p := s.c.OpenProject(req.Data)
+		if p == nil {
+			return &socketResponse{Message: "unknown project"}
 		}
-		d := s.parseSocketData(msg)
-		if d == nil {
-			log.Print("incomming data are not valid")
-			con.Write([]byte{byte(socketResponseFail), '\n'})
-			con.Close()
-			continue
+		name := s.c.StartJob(p, req.Params, &JobCause{Trigger: causeScript, Project: s.j.p.name, Job: s.j.name}, nil)
+		if name == "" && p.Disabled() != nil {
+			return &socketResponse{Message: "project is disabled"}
+		} else if name == "" {
+			return &socketResponse{Message: "job could not be started"}
 		}
+		result := &socketResponse{Ok: true, Job: name, Status: InProgress}
+		if req.Wait {
+			result.Status = s.waitForJob(s.c.OpenJob(p, name), req.Output, con)
+		}
+		return result
+	case socketActionStage:
+		if s.j.stages == nil {
+			return &socketResponse{Message: "job has no stages"}
+		}
+		s.j.stages.Start(req.Data)
+	case socketActionProgress:
+		progress, err := strconv.Atoi(req.Data)
+		if err != nil || progress < 0 || progress > 100 {
+			return &socketResponse{Message: "progress should be a number from 0 to 100"}
+		}
+		if s.j.stages == nil || !s.j.stages.Progress(progress) {
+			return &socketResponse{Message: "no stage is running"}
+		}
+	case socketActionMeta:
+		if err := s.j.SetMeta(req.Data, req.Value); err != nil {
+			return &socketResponse{Message: err.Error()}
+		}
+	case socketActionArtifact:
+		if err := s.j.PublishArtifact(req.Data, req.Value); err != nil {
+			return &socketResponse{Message: err.Error()}
+		}
+	case socketActionStatus:
+		p := s.c.OpenProject(req.Data)
+		if p == nil {
+			return &socketResponse{Message: "unknown project"}
+		}
+		jobs, err := s.c.ListJobs(p)
+		if err != nil || len(jobs) == 0 {
+			return &socketResponse{Message: "project has no jobs"}
+		}
+		status := jobs[0].Status()
+		if s.c.IsBeingBuilt(jobs[0]) {
+			status = InProgress
+		}
+		return &socketResponse{Ok: true, Job: jobs[0].name, Status: status}
+	default:
+		return &socketResponse{Message: "unknown action"}
+	}
+	s.c.broadcastUpdate(s.j)
+	return &socketResponse{Ok: true}
+}
 
-		response := socketResponseFail
-
-		switch d.action {
-		case socketActionStart:
-			p := s.c.OpenProject(d.data)
-			if p != nil {
-				if r := s.c.StartJob(p, nil); r != "" {
-					response = socketResponseOk
-				}
+// Waits until job ends or job of socket is stopped, output of job is sent as partial responses
+func (s *socketServerContext) waitForJob(b *Job, output bool, con io.Writer) JobStatus {
+	var offset int64
+	for {
+		running := s.c.IsBeingBuilt(b)
+		if output {
+			if err := s.sendOutput(b, &offset, con); err != nil {
+				return InProgress
 			}
 		}
+		if !running {
+			return b.Status()
+		}
+		if s.j.isStopped() {
+			return InProgress
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
 
-		con.Write([]byte{byte(response), '\n'})
-		con.Close()
+// Sends new output of job from offset as partial response
+func (s *socketServerContext) sendOutput(b *Job, offset *int64, con io.Writer) error {
+	f, err := os.Open(b.OutputPath())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	f.Seek(*offset, io.SeekStart)
+	data, _ := io.ReadAll(io.LimitReader(f, socketMaxLength/2))
+	// Incomplete character is sent with the next part
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				data = data[:i]
+			}
+			break
+		}
 	}
+	if len(data) == 0 {
+		return nil
+	}
+	*offset += int64(len(data))
+	return writeSocketMessage(con, &socketResponse{Ok: true, Job: b.name, Status: InProgress, Output: string(data), Partial: true})
 }
 
 func (s *socketServerContext) stop() {
 	s.l.Close()
 }
 
-func makeSocketClientAction(action socketAction, data string) int {
-	s := &socketData{action: action, data: data}
-	s.token = os.Getenv(envSocketToken)
+// Gets exit code of client reflecting status of job
+func statusExitCode(status JobStatus) int {
+	switch status {
+	case Finished:
+		return exitCodeOk
+	case Failed:
+		return exitCodeFailed
+	case Stopped:
+		return exitCodeStopped
+	case InProgress:
+		return exitCodeInProgress
+	}
+	return exitCodeUnknown
+}
+
+// Calls lurch from build script, output of waited job and printed status are written into out
+func makeSocketClientAction(conf *Config, out io.Writer) int {
+	req := &socketRequest{Token: os.Getenv(envSocketToken), Action: conf.action, Data: conf.data, Value: conf.value, Params: conf.params, Wait: conf.wait, Output: conf.wait && conf.waitOutput != waitOutputNone}
 
 	con, err := net.Dial("tcp", fmt.Sprintf("localhost:%s", os.Getenv(envSocketPort)))
 	if err != nil {
 		log.Println(err)
-		return int(socketResponseFail)
+		return exitCodeFail
 	}
 	defer con.Close()
+	if conf.wait && conf.waitTimeout > 0 {
+		con.SetDeadline(time.Now().Add(conf.waitTimeout))
+	}
 
-	con.Write([]byte(s.String() + "\n"))
-	res, err := bufio.NewReader(con).ReadString('\n')
-	if err != nil {
+	if err := writeSocketMessage(con, req); err != nil {
 		log.Println(err)
+		return exitCodeFail
+	}
+
+	var res socketResponse
+	var output strings.Builder
+	r := bufio.NewReader(con)
+	for {
+		job := res.Job
+		res = socketResponse{}
+		if err := readSocketMessage(r, &res); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				io.WriteString(out, output.String())
+				log.Printf("timeout %s expired, job #%s of %s is still running", conf.waitTimeout, job, conf.data)
+				return exitCodeInProgress
+			}
+			log.Println(err)
+			return exitCodeFail
+		}
+		if !res.Partial {
+			break
+		}
+		if conf.waitOutput == waitOutputEnd {
+			output.WriteString(res.Output)
+		} else {
+			io.WriteString(out, res.Output)
+		}
 	}
+	io.WriteString(out, output.String())
 
-	log.Print("result code: ", int(res[0]))
+	if !res.Ok {
+		log.Print("request failed: ", res.Message)
+		return exitCodeFail
+	}
 
-	return int(res[0])
+	switch {
+	case conf.action == socketActionStatus:
+		fmt.Fprintln(out, res.Status)
+		return statusExitCode(res.Status)
+	case conf.action == socketActionStart && conf.wait:
+		log.Printf("job #%s of %s %s", res.Job, conf.data, res.Status)
+		return statusExitCode(res.Status)
+	case conf.action == socketActionStart:
+		log.Printf("job #%s of %s started", res.Job, conf.data)
+	}
+	return exitCodeOk
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSocketMessage(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writeSocketMessage(buf, &socketRequest{Token: "token", Action: socketActionStart, Data: "project name", Params: map[string]string{"KEY": "a\nb"}}); err != nil {
+		t.Fatal("TestSocketMessage: unexpected error", err)
+	}
+	if !strings.HasPrefix(buf.String(), "lurch/1 ") {
+		t.Fatalf("TestSocketMessage: unexpected header '%s'", buf.String())
+	}
+
+	var req socketRequest
+	if err := readSocketMessage(bufio.NewReader(buf), &req); err != nil {
+		t.Fatal("TestSocketMessage: unexpected error", err)
+	}
+	if req.Token != "token" || req.Action != socketActionStart || req.Data != "project name" || req.Params["KEY"] != "a\nb" {
+		t.Fatalf("TestSocketMessage: unexpected message %v", req)
+	}
+
+	for _, data := range []string{"lurch/2 2\n{}", "lurch/1 10\n{}", "token 1 7 project\n", "lurch/1 -1\n"} {
+		if err := readSocketMessage(bufio.NewReader(strings.NewReader(data)), &req); err == nil {
+			t.Fatalf("TestSocketMessage: expected error for '%s'", data)
+		}
+	}
+}
+
+func TestSocketActions(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	NewWebSocketService(c)
+
+	p := c.OpenProject("upstream")
+	downstream := c.OpenProject("downstream")
+	for _, dir := range []string{p.dir, downstream.dir} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			panic(err)
+		}
+	}
+	os.WriteFile(filepath.Join(downstream.dir, "script.sh"), []byte("#!/bin/sh\n\necho \"target $TARGET\"\nexit 1"), 0755)
+
+	b, _ := p.NewJob()
+	b.MkWorkspace()
+	b.stages = newStageTracker(b, &bytes.Buffer{})
+	s := startServerSocket(c, b)
+	defer s.stop()
+
+	t.Setenv(envSocketPort, strconv.Itoa(s.port))
+	t.Setenv(envSocketToken, s.token)
+
+	out := &bytes.Buffer{}
+	call := func(args ...string) int {
+		out.Reset()
+		return makeSocketClientAction(LoadConfig(args), out)
+	}
+
+	if code := call("-sj", "downstream", "-P", "target=prod", "--wait"); code != exitCodeFailed {
+		t.Fatalf("TestSocketActions: waiting for failed job returned %d", code)
+	}
+	if output, _ := c.OpenJob(downstream, "1").ReadOutput(); !strings.Contains(output, "target prod") || output != out.String() {
+		t.Fatalf("TestSocketActions: output was not streamed:\n%s\n%s", output, out.String())
+	}
+	if cause := c.OpenJob(downstream, "1").Cause(); cause == nil || cause.Trigger != causeScript || cause.Project != "upstream" || cause.Job != b.name {
+		t.Fatalf("TestSocketActions: unexpected cause %v", cause)
+	}
+	if code := call("-sj", "downstream", "-w", "-wo", "none"); code != exitCodeFailed || out.Len() != 0 {
+		t.Fatalf("TestSocketActions: waiting without output returned %d:\n%s", code, out.String())
+	}
+	if code := call("-sq", "downstream"); code != exitCodeFailed || out.String() != "failed\n" {
+		t.Fatalf("TestSocketActions: status of failed job returned %d:\n%s", code, out.String())
+	}
+	os.WriteFile(filepath.Join(downstream.dir, "script.sh"), []byte("#!/bin/sh\n\necho started\nsleep 10"), 0755)
+	start := time.Now()
+	if code := call("-sj", "downstream", "-w", "-wt", "1", "-wo", "end"); code != exitCodeInProgress || time.Since(start) > 3*time.Second || out.String() != "started\n" {
+		t.Fatalf("TestSocketActions: waiting with timeout returned %d:\n%s", code, out.String())
+	}
+	c.Interrupt(c.OpenJob(downstream, "3"))
+
+	if code := call("-sq", "unknown"); code != exitCodeFail {
+		t.Fatalf("TestSocketActions: status of unknown project returned %d", code)
+	}
+
+	if code := call("-sp", "50"); code != exitCodeFail {
+		t.Fatal("TestSocketActions: progress without stage should fail")
+	}
+	call("-ss", "build")
+	call("-sp", "50")
+	if stages := b.Stages(); len(stages) != 1 || stages[0].Name != "build" || stages[0].Progress != 50 {
+		t.Fatalf("TestSocketActions: unexpected stages %v", stages)
+	}
+
+	call("-sm", "description=Nightly build")
+	call("-sm", "version=1.2.3")
+	call("-sm", "badge=nightly")
+	call("-sm", "badge=green")
+	if code := call("-sm", "owner=me"); code != exitCodeFail {
+		t.Fatal("TestSocketActions: unknown metadata should fail")
+	}
+	if meta := b.Meta(); meta == nil || meta.Description != "Nightly build" || meta.Version != "1.2.3" || strings.Join(meta.Badges, ",") != "nightly,green" {
+		t.Fatalf("TestSocketActions: unexpected metadata %v", meta)
+	}
+
+	os.WriteFile(filepath.Join(b.WorkspacePath(), "app.bin"), []byte("binary"), 0644)
+	os.WriteFile(filepath.Join(tmpdir, "secret"), []byte("secret"), 0644)
+	if code := call("-sa", "app="+filepath.Join(b.WorkspacePath(), "app.bin")); code != exitCodeOk {
+		t.Fatalf("TestSocketActions: publishing artifact returned %d", code)
+	}
+	for _, arg := range []string{"../app=" + filepath.Join(b.WorkspacePath(), "app.bin"), "secret=" + filepath.Join(tmpdir, "secret"), "ws=" + b.WorkspacePath()} {
+		if code := call("-sa", arg); code != exitCodeFail {
+			t.Fatalf("TestSocketActions: publishing artifact %s should fail", arg)
+		}
+	}
+	if artifacts := b.Artifacts(); len(artifacts) != 1 || artifacts[0] != "app" {
+		t.Fatalf("TestSocketActions: unexpected artifacts %v", artifacts)
+	}
+
+	t.Setenv(envSocketToken, "wrong")
+	if code := call("-ss", "test"); code != exitCodeFail {
+		t.Fatal("TestSocketActions: wrong token should fail")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var stageControlLine = regexp.MustCompile(`^::stage (.+)::$`)
+
+type Stage struct {
+	Name      string    `json:"name"`
+	Group     string    `json:"group,omitempty"`
+	Status    JobStatus `json:"status"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Line      int       `json:"line"`
+	Progress  int       `json:"progress,omitempty"`
+}
+
+// Tracks stages of running job, it is also writer of job output looking for stage control lines
+type stageTracker struct {
+	mutex   *sync.Mutex
+	path    string
+	w       io.Writer
+	lines   int
+	partial []byte
+	stages  []*Stage
+	started func(stage *Stage)
+	remote  bool
+	offset  int
+	base    int
+}
+
+func newStageTracker(b *Job, w io.Writer) *stageTracker {
+	return &stageTracker{mutex: &sync.Mutex{}, path: b.StagesPath(), w: w}
+}
+
+// Writes data into output and starts new stage for each control line
+func (t *stageTracker) Write(data []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.write(data)
+}
+
+// Writes data into output while mutex is locked, so lines of stages match the output
+func (t *stageTracker) write(data []byte) (int, error) {
+	n, err := t.w.Write(data)
+	t.partial = append(t.partial, data[:n]...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimRight(t.partial[:i], "\r")
+		if m := stageControlLine.FindSubmatch(line); m != nil && !t.remote {
+			t.start(string(bytes.TrimSpace(m[1])))
+		}
+		t.lines++
+		t.partial = t.partial[i+1:]
+	}
+	return n, err
+}
+
+// Finishes current stage and starts new one
+func (t *stageTracker) Start(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.start(name)
+}
+
+func (t *stageTracker) start(name string) {
+	if name == "" {
+		return
+	}
+	now := time.Now()
+	t.end(Finished, now)
+	t.stages = append(t.stages, &Stage{Name: name, Status: InProgress, StartDate: now, Line: t.lines})
+	t.save()
+	t.notify(t.stages[len(t.stages)-1])
+}
+
+// Ends current stage with status
+func (t *stageTracker) End(status JobStatus) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.end(status, time.Now())
+	t.save()
+}
+
+// Sets progress of current stage in percents, false is returned if no stage is running
+func (t *stageTracker) Progress(progress int) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i := len(t.stages) - 1; i >= 0; i-- {
+		if t.stages[i].Status == InProgress {
+			t.stages[i].Progress = progress
+			t.save()
+			return true
+		}
+	}
+	return false
+}
+
+// Finishes incomplete line of output, so following output starts on new line
+func (t *stageTracker) lineBreak() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.partial) > 0 {
+		t.write([]byte("\n"))
+	}
+}
+
+// Switches to output of job running on agent, control lines are not parsed, because agent reports its stages
+func (t *stageTracker) startRemote() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.partial) > 0 {
+		t.write([]byte("\n"))
+	}
+	t.remote = true
+	t.offset = t.lines
+	t.base = len(t.stages)
+}
+
+// Replaces stages reported by agent, their lines are moved after output written before the agent started
+func (t *stageTracker) Report(stages []*Stage) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	known := len(t.stages) - t.base
+	for _, stage := range stages {
+		stage.Line += t.offset
+	}
+	t.stages = append(t.stages[:t.base], stages...)
+	t.save()
+	for _, stage := range stages[min(known, len(stages)):] {
+		t.notify(stage)
+	}
+}
+
+// Appends output of already ended stage, control lines in the output are ignored
+func (t *stageTracker) Append(stage *Stage, output io.Reader) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.partial) > 0 {
+		t.partial = nil
+		t.lines++
+		if _, err := t.w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	stage.Line = t.lines
+	t.stages = append(t.stages, stage)
+	t.save()
+	t.notify(stage)
+
+	t.lines++
+	if _, err := fmt.Fprintf(t.w, "::stage %s::\n", stage.Name); err != nil {
+		return err
+	}
+	w := &lineCounter{w: t.w}
+	_, err := io.Copy(w, output)
+	t.lines += w.lines
+	if err == nil && w.last != 0 && w.last != '\n' {
+		t.lines++
+		_, err = t.w.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// Writer counting lines written into underlying writer
+type lineCounter struct {
+	w     io.Writer
+	lines int
+	last  byte
+}
+
+func (c *lineCounter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	c.lines += bytes.Count(data[:n], []byte{'\n'})
+	if n > 0 {
+		c.last = data[n-1]
+	}
+	return n, err
+}
+
+// Reports started or appended stage
+func (t *stageTracker) notify(stage *Stage) {
+	if t.started != nil {
+		t.started(stage)
+	}
+}
+
+// Ends the last stage in progress
+func (t *stageTracker) end(status JobStatus, date time.Time) {
+	for i := len(t.stages) - 1; i >= 0; i-- {
+		if t.stages[i].Status == InProgress {
+			t.stages[i].Status = status
+			t.stages[i].EndDate = date
+			return
+		}
+	}
+}
+
+func (t *stageTracker) save() error {
+	if len(t.stages) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(t.stages)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0644)
+}
+
+// Loads stages from file, if not found, leave method without drama
+func loadStages(path string) []Stage {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var result []Stage
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	return result
+}
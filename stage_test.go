@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStageTracker(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	jobPath := filepath.Join(tmpdir, "build-1")
+	if err := os.Mkdir(jobPath, 0755); err != nil {
+		panic(err)
+	}
+
+	b := &Job{name: "1", dir: jobPath}
+	output := &bytes.Buffer{}
+	tracker := newStageTracker(b, output)
+
+	tracker.Write([]byte("preparing\n::stage build::\ncompiling\n::sta"))
+	tracker.Write([]byte("ge test suite::\r\nrunning tests\n"))
+	tracker.Start("deploy")
+	tracker.End(Failed)
+
+	if output.String() != "preparing\n::stage build::\ncompiling\n::stage test suite::\r\nrunning tests\n" {
+		t.Fatalf("TestStageTracker: unexpected output '%s'", output.String())
+	}
+
+	stages := b.Stages()
+	if len(stages) != 3 {
+		t.Fatalf("TestStageTracker: unexpected count of stages %d", len(stages))
+	}
+
+	expected := []Stage{{Name: "build", Status: Finished, Line: 1}, {Name: "test suite", Status: Finished, Line: 3}, {Name: "deploy", Status: Failed, Line: 5}}
+	for i, s := range expected {
+		if stages[i].Name != s.Name || stages[i].Status != s.Status || stages[i].Line != s.Line {
+			t.Fatalf("TestStageTracker: unexpected stage %v instead of %v", stages[i], s)
+		}
+		if stages[i].EndDate.Before(stages[i].StartDate) {
+			t.Fatalf("TestStageTracker: stage '%s' ends before it starts", s.Name)
+		}
+	}
+}
+
+func TestNoStages(t *testing.T) {
+	b := &Job{name: "1", dir: filepath.Join(os.TempDir(), "lurch-missing-job")}
+	if stages := b.Stages(); stages != nil {
+		t.Fatalf("TestNoStages: unexpected stages %v", stages)
+	}
+}
+
+func TestStageTrackerConcurrentWrites(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	b := &Job{name: "1", dir: tmpdir}
+	output := &bytes.Buffer{}
+	tracker := newStageTracker(b, output)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				fmt.Fprintf(tracker, "::stage %d-%d::\noutput of %d\n", i, j, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(output.String(), "\n")
+	for _, s := range tracker.stages {
+		if s.Line >= len(lines) || lines[s.Line] != "::stage "+s.Name+"::" {
+			t.Fatalf("TestStageTrackerConcurrentWrites: stage '%s' does not start on line %d", s.Name, s.Line)
+		}
+	}
+}
+
+func TestStageTrackerAppend(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	b := &Job{name: "1", dir: tmpdir}
+	output := &bytes.Buffer{}
+	tracker := newStageTracker(b, output)
+
+	tracker.Write([]byte("preparing"))
+	tracker.Append(&Stage{Name: "branch", Status: Finished}, strings.NewReader("::stage ignored::\nlast line"))
+	tracker.Write([]byte("::stage next::\n"))
+
+	if output.String() != "preparing\n::stage branch::\n::stage ignored::\nlast line\n::stage next::\n" {
+		t.Fatalf("TestStageTrackerAppend: unexpected output '%s'", output.String())
+	}
+	stages := b.Stages()
+	if len(stages) != 2 || stages[0].Name != "branch" || stages[0].Line != 1 || stages[1].Name != "next" || stages[1].Line != 4 {
+		t.Fatalf("TestStageTrackerAppend: unexpected stages %v", stages)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Count of records of ended jobs kept in statistics of project
+const statsLimit = 1000
+
+// Count of the latest records returned as trend of project
+const statsTrendLength = 50
+
+var statsMutex = &sync.Mutex{}
+
+// Record of ended job kept in statistics of project, that survives removal of old jobs
+type StatsRecord struct {
+	Job       string    `json:"job"`
+	Status    JobStatus `json:"status"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+}
+
+// Duration of recorded job in seconds
+func (r *StatsRecord) Duration() float64 {
+	return max(r.EndDate.Sub(r.StartDate).Seconds(), 0)
+}
+
+// Aggregated statistics of project
+type ProjectStats struct {
+	Jobs                 int           `json:"jobs"`
+	Finished             int           `json:"finished"`
+	Failed               int           `json:"failed"`
+	Stopped              int           `json:"stopped"`
+	SuccessRate          float64       `json:"successRate"`
+	MeanDuration         float64       `json:"meanDuration"`
+	P95Duration          float64       `json:"p95Duration"`
+	FailureStreak        int           `json:"failureStreak"`
+	LongestFailureStreak int           `json:"longestFailureStreak"`
+	MeanRecovery         float64       `json:"mttr"`
+	Recoveries           int           `json:"recoveries"`
+	Since                time.Time     `json:"since"`
+	Trend                []StatsRecord `json:"trend"`
+}
+
+// Path to statistics of project
+func (p *Project) StatsPath() string {
+	return filepath.Join(p.dir, "stats")
+}
+
+// Loads records of ended jobs from the oldest one
+func (p *Project) LoadStats() []StatsRecord {
+	f, err := os.Open(p.StatsPath())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	result := make([]StatsRecord, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r StatsRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err == nil {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Saves records of ended jobs, only the latest ones are kept
+func (p *Project) saveStats(records []StatsRecord) error {
+	if len(records) > statsLimit {
+		records = records[len(records)-statsLimit:]
+	}
+	f, err := os.Create(p.StatsPath())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	e := json.NewEncoder(w)
+	for _, r := range records {
+		e.Encode(r)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Records ended job into statistics of project, statistics are initialized from jobs in history if they do not exist
+func (c *Context) recordStats(b *Job, status JobStatus) error {
+	if b.parent != nil || c.conf.isAgent() {
+		return nil
+	}
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+
+	records := append(c.loadStats(b.p, b), StatsRecord{Job: b.name, Status: status, StartDate: b.StartDate(), EndDate: b.EndDate()})
+	return b.p.saveStats(records)
+}
+
+// Loads records of ended jobs of project, if statistics do not exist, they are made of ended jobs in history except skipped one
+func (c *Context) loadStats(p *Project, skip *Job) []StatsRecord {
+	if records := p.LoadStats(); records != nil {
+		return records
+	}
+	result := make([]StatsRecord, 0)
+	jobs, err := c.ListJobs(p)
+	if err != nil {
+		return result
+	}
+	for _, b := range slices.Backward(jobs) {
+		if s := b.Status(); (skip == nil || !b.Equals(skip)) && isNumber(b.name) && s != Unknown && s != InProgress {
+			result = append(result, StatsRecord{Job: b.name, Status: s, StartDate: b.StartDate(), EndDate: b.EndDate()})
+		}
+	}
+	return result
+}
+
+// Aggregates records of ended jobs from the oldest one into statistics
+func aggregateStats(records []StatsRecord) *ProjectStats {
+	result := &ProjectStats{Jobs: len(records), Trend: make([]StatsRecord, 0)}
+	if len(records) == 0 {
+		return result
+	}
+	result.Since = records[0].StartDate
+
+	durations := make([]float64, 0, len(records))
+	var recovery float64
+	var failedAt time.Time
+	for _, r := range records {
+		durations = append(durations, r.Duration())
+		switch r.Status {
+		case Finished:
+			result.Finished++
+			if !failedAt.IsZero() {
+				recovery += r.EndDate.Sub(failedAt).Seconds()
+				result.Recoveries++
+				failedAt = time.Time{}
+			}
+			result.FailureStreak = 0
+		case Failed:
+			result.Failed++
+			if failedAt.IsZero() {
+				failedAt = r.EndDate
+			}
+			result.FailureStreak++
+			result.LongestFailureStreak = max(result.LongestFailureStreak, result.FailureStreak)
+		case Stopped:
+			result.Stopped++
+		}
+	}
+
+	if result.Finished+result.Failed > 0 {
+		result.SuccessRate = float64(result.Finished) / float64(result.Finished+result.Failed)
+	}
+	if result.Recoveries > 0 {
+		result.MeanRecovery = recovery / float64(result.Recoveries)
+	}
+
+	var sum float64
+	for _, d := range durations {
+		sum += d
+	}
+	result.MeanDuration = sum / float64(len(durations))
+	slices.Sort(durations)
+	result.P95Duration = durations[(len(durations)*95+99)/100-1]
+
+	result.Trend = records[max(len(records)-statsTrendLength, 0):]
+	return result
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAggregateStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := make([]StatsRecord, 0)
+	for i, status := range []JobStatus{Finished, Failed, Failed, Stopped, Finished, Failed, Finished, Failed, Failed, Failed} {
+		begin := start.Add(time.Duration(i) * time.Hour)
+		records = append(records, StatsRecord{Status: status, StartDate: begin, EndDate: begin.Add(time.Duration(i+1) * time.Minute)})
+	}
+
+	stats := aggregateStats(records)
+	if stats.Jobs != 10 || stats.Finished != 3 || stats.Failed != 6 || stats.Stopped != 1 || stats.SuccessRate != 1.0/3 {
+		t.Fatalf("TestAggregateStats: unexpected counts %v", stats)
+	}
+	if stats.MeanDuration != 330 || stats.P95Duration != 600 {
+		t.Fatalf("TestAggregateStats: unexpected durations %f %f", stats.MeanDuration, stats.P95Duration)
+	}
+	if stats.FailureStreak != 3 || stats.LongestFailureStreak != 3 {
+		t.Fatalf("TestAggregateStats: unexpected streaks %d %d", stats.FailureStreak, stats.LongestFailureStreak)
+	}
+	// Recovered from 13:02 to 16:05 and from 17:06 to 18:07
+	if stats.Recoveries != 2 || stats.MeanRecovery != (3*3600+3*60+3600+60)/2 {
+		t.Fatalf("TestAggregateStats: unexpected recovery %d %f", stats.Recoveries, stats.MeanRecovery)
+	}
+	if len(stats.Trend) != 10 || !stats.Since.Equal(start) {
+		t.Fatalf("TestAggregateStats: unexpected trend %v", stats.Trend)
+	}
+
+	if empty := aggregateStats(nil); empty.Jobs != 0 || empty.Trend == nil {
+		t.Fatalf("TestAggregateStats: unexpected empty stats %v", empty)
+	}
+}
+
+func TestRecordStats(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", tmpdir}))
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	for _, status := range []JobStatus{Finished, Failed} {
+		b, _ := p.NewJob()
+		b.LogStart()
+		b.SetStatus(status)
+	}
+	b, _ := p.NewJob()
+	b.LogStart()
+	b.SetStatus(Finished)
+
+	if err := c.recordStats(b, Finished); err != nil {
+		t.Fatal("TestRecordStats: unexpected error", err)
+	}
+	for i := 0; i < 12; i++ {
+		p.NewJob()
+	}
+	c.removeOldjobs(p)
+
+	records := c.loadStats(p, nil)
+	if len(records) != 3 || records[0].Job != "1" || records[1].Status != Failed || records[2].Job != "3" {
+		t.Fatalf("TestRecordStats: unexpected records %v", records)
+	}
+
+	child := &Job{name: "3.1", p: p, parent: b}
+	c.recordStats(child, Failed)
+	if records := p.LoadStats(); len(records) != 3 {
+		t.Fatalf("TestRecordStats: child job should not be recorded %v", records)
+	}
+}
@@ -73,3 +73,16 @@ func randomToken(n int) string {
 	}
 	return string(b)
 }
+
+// Checks if value consists only of digits
+func isNumber(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -8,7 +8,10 @@ import (
 	"log"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -19,6 +22,7 @@ var www embed.FS
 type WebService struct {
 	c      *Context
 	layout *template.Template
+	editor *template.Template
 }
 
 func NewWebService(c *Context) *WebService {
@@ -30,6 +34,10 @@ func NewWebService(c *Context) *WebService {
 	}
 	result.layout = tpl
 
+	if result.editor, err = template.ParseFS(www, "www/editor.html"); err != nil {
+		log.Fatal(err)
+	}
+
 	return result
 }
 
@@ -37,7 +45,15 @@ type PageContext struct {
 	s              *WebService
 	Name           string
 	ProjectVersion string
-	Projects       []string
+	Groups         []*PageGroup
+	Draining       bool
+	Project        string
+}
+
+// Projects shown together in web UI, projects directly in work dir have group without name
+type PageGroup struct {
+	Name     string
+	Projects []string
 }
 
 func (p *PageContext) UrlFor(path string) string {
@@ -50,20 +66,26 @@ func (p *PageContext) UrlFor(path string) string {
 func (s *WebService) HandleFunc(w http.ResponseWriter, r *http.Request) {
 	if strings.HasPrefix(r.URL.Path, "/static/") {
 		f, _ := www.ReadFile("www" + r.URL.Path)
-		w.Header().Set("content-type", s.getMimeType(r.URL.Path))
+		w.Header().Set("content-type", getMimeType(r.URL.Path))
 		w.Write(f)
 		return
 	} else if r.URL.Path == "" || r.URL.Path == "/" || r.URL.Path == "index.html" {
 		s.loadIndex(w, r)
+	} else if r.URL.Path == "/edit" {
+		s.loadEditor(w, r)
 	} else if strings.HasPrefix(r.URL.Path, "/download") {
 		s.downloadArtifact(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/badge/") {
+		s.serveBadge(w, r)
+	} else if r.URL.Path == "/feed.atom" || strings.HasPrefix(r.URL.Path, "/feed/") {
+		s.serveFeed(w, r)
 	} else {
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
 func (s *WebService) loadIndex(w http.ResponseWriter, r *http.Request) {
-	p := &PageContext{s: s, ProjectVersion: s.c.conf.GetVersion(), Name: s.c.conf.name}
+	p := &PageContext{s: s, ProjectVersion: s.c.conf.GetVersion(), Name: s.c.conf.name, Draining: s.c.IsDraining()}
 	w.Header().Set("content-type", "text/html")
 
 	projects, err := s.c.ListProjects()
@@ -72,8 +94,14 @@ func (s *WebService) loadIndex(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 	}
 
+	p.Groups = []*PageGroup{{}}
 	for _, proj := range projects {
-		p.Projects = append(p.Projects, proj.name)
+		i := slices.IndexFunc(p.Groups, func(g *PageGroup) bool { return g.Name == proj.Group() })
+		if i < 0 {
+			i = len(p.Groups)
+			p.Groups = append(p.Groups, &PageGroup{Name: proj.Group()})
+		}
+		p.Groups[i].Projects = append(p.Groups[i].Projects, proj.name)
 	}
 
 	if err := s.layout.Execute(w, p); err != nil {
@@ -82,30 +110,79 @@ func (s *WebService) loadIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Loads page with editor of build script and settings of project
+func (s *WebService) loadEditor(w http.ResponseWriter, r *http.Request) {
+	p := &PageContext{s: s, ProjectVersion: s.c.conf.GetVersion(), Name: s.c.conf.name, Project: r.URL.Query().Get("project")}
+
+	project := s.c.OpenProject(p.Project)
+	if project == nil || s.c.validateProjectName(p.Project) != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !project.Exists() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("content-type", "text/html")
+	if err := s.editor.Execute(w, p); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+	}
+}
+
 func (s *WebService) downloadArtifact(w http.ResponseWriter, r *http.Request) {
-	path := strings.Split(r.URL.Path, "/")
+	path := strings.Split(r.URL.EscapedPath(), "/")
+	for i, segment := range path {
+		path[i], _ = url.PathUnescape(segment)
+	}
 	if len(path) > 3 {
-		p := s.c.OpenProject(path[2])
-		j := s.c.OpenJob(p, path[3])
-
-		f, err := os.Open(j.ArtifactPath())
-		if err != nil {
+		name := ""
+		if len(path) > 4 {
+			name = path[4]
+		}
+		if !serveArtifact(w, RestService{c: s.c}.openJob(path[2], path[3]), name) {
 			w.WriteHeader(http.StatusNotFound)
-			return
 		}
-		defer f.Close()
-
-		w.Header().Set("content-type", s.getMimeType(j.ArtifactPath()))
-		w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=\"%s_%s.tar.gz\"", p.name, j.name))
-		w.Header().Set("content-length", strconv.FormatInt(j.ArtifactSize(), 10))
-
-		w.WriteHeader(http.StatusOK)
-		io.Copy(w, f)
 	} else {
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
-func (s *WebService) getMimeType(path string) string {
-	return mime.TypeByExtension(path[strings.LastIndex(path, "."):])
+// Serves archive of workspace or named artifact of job, false is returned if artifact does not exist
+func serveArtifact(w http.ResponseWriter, j *Job, name string) bool {
+	if j == nil {
+		return false
+	}
+	file := j.ArtifactPath()
+	fileName := fmt.Sprintf("%s_%s.tar.gz", j.p.name, j.name)
+	if name != "" {
+		file = j.NamedArtifactPath(name)
+		fileName = name
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		return false
+	}
+
+	w.Header().Set("content-type", getMimeType(fileName))
+	w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	w.Header().Set("content-length", strconv.FormatInt(stat.Size(), 10))
+
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, f)
+	return true
+}
+
+func getMimeType(path string) string {
+	if result := mime.TypeByExtension(filepath.Ext(path)); result != "" {
+		return result
+	}
+	return "application/octet-stream"
 }
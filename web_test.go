@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadArtifact(t *testing.T) {
+	tmpdir, err := os.MkdirTemp(os.TempDir(), "lurch-test-workdir")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	c := NewContext(LoadConfig([]string{"-t", filepath.Join(tmpdir, "workdir")}))
+	p := c.OpenProject("project")
+	if err = os.MkdirAll(p.dir, 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(p.ScriptPath(), []byte("#!/bin/sh\n"), 0755)
+	b, _ := p.NewJob()
+	os.WriteFile(b.ArtifactPath(), []byte("artifact"), 0644)
+
+	// Archive outside of work dir must not be reachable
+	if err = os.MkdirAll(filepath.Join(tmpdir, "outside"), 0755); err != nil {
+		panic(err)
+	}
+	os.WriteFile(filepath.Join(tmpdir, "outside", "workspace.tar.gz"), []byte("secret"), 0644)
+
+	s := NewWebService(c)
+	for url, code := range map[string]int{
+		"/download/project/1":                 http.StatusOK,
+		"/download/project/..%2F..%2Foutside": http.StatusNotFound,
+		"/download/..%2Foutside/.":            http.StatusNotFound,
+		"/download/project/1%2F..%2F..%2F..":  http.StatusNotFound,
+		"/download/project/2":                 http.StatusNotFound,
+		"/download/missing/1":                 http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		s.HandleFunc(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != code {
+			t.Fatalf("TestDownloadArtifact: unexpected response %d to %s", w.Code, url)
+		}
+		if code == http.StatusOK && w.Body.String() != "artifact" {
+			t.Fatalf("TestDownloadArtifact: unexpected artifact '%s'", w.Body.String())
+		}
+	}
+}
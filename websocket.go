@@ -1,76 +1,170 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
+	"log"
 	"sync"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
 
+const (
+	wsQueueSize      = 64
+	wsPingInterval   = 30 * time.Second
+	wsWriteTimeout   = 10 * time.Second
+	wsMaxMessageSize = 4096
+)
+
 type WsService struct {
-	c     *Context
-	mutex *sync.Mutex
-	cons  []*WsConnection
+	c            *Context
+	mutex        *sync.Mutex
+	cons         map[*WsConnection]bool
+	pingInterval time.Duration
 }
 
+// Connection of web UI client with queue of messages waiting to be sent
 type WsConnection struct {
-	id  string
-	con *websocket.Conn
-	msg chan string
+	con    *websocket.Conn
+	msg    chan string
+	closed chan bool
+	once   *sync.Once
+}
+
+// Codec of empty ping frame
+var wsPing = websocket.Codec{Marshal: func(v any) ([]byte, byte, error) {
+	return nil, websocket.PingFrame, nil
+}}
+
+// Message sent by web UI client
+type wsClientMessage struct {
+	Ping bool `json:"ping"`
 }
 
 func NewWebSocketService(c *Context) *WsService {
-	w := &WsService{c: c, mutex: &sync.Mutex{}}
+	w := &WsService{c: c, mutex: &sync.Mutex{}, cons: make(map[*WsConnection]bool), pingInterval: wsPingInterval}
 	c.wsService = w
 	return w
 }
 
+// Serves connection of client until it is closed, stops responding or could not keep up with broadcasted messages
 func (w *WsService) HandleWebSocket(con *websocket.Conn) {
-	wsCon := &WsConnection{con: con, msg: make(chan string), id: randomToken(8)}
+	wsCon := &WsConnection{con: con, msg: make(chan string, wsQueueSize), closed: make(chan bool), once: &sync.Once{}}
 
 	w.mutex.Lock()
-	w.cons = append(w.cons, wsCon)
+	w.cons[wsCon] = true
 	w.mutex.Unlock()
 
 	defer con.Close()
+	defer w.remove(wsCon)
+
+	go func() {
+		readWebSocket(con, 2*w.pingInterval, func(data []byte) {
+			w.handleMessage(wsCon, data)
+		})
+		wsCon.close()
+	}()
 
+	ping := time.NewTicker(w.pingInterval)
+	defer ping.Stop()
 	for {
-		msg := <-wsCon.msg
-		if err := websocket.Message.Send(con, msg); err != nil {
-			w.removeFromSlice(wsCon)
-			break
+		select {
+		case msg := <-wsCon.msg:
+			con.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := websocket.Message.Send(con, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := pingWebSocket(con); err != nil {
+				return
+			}
+		case <-wsCon.closed:
+			return
 		}
 	}
 }
 
+// Queues message for all clients without blocking, client with full queue is disconnected and reloads its state after reconnect
 func (w *WsService) Broadcast(msg string) {
-	for _, wsCon := range w.cons {
-		wsCon.msg <- msg
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for wsCon := range w.cons {
+		if !wsCon.send(msg) {
+			log.Print("-- disconnecting slow web socket client")
+			delete(w.cons, wsCon)
+			wsCon.close()
+		}
 	}
 }
 
-func (w *WsService) removeFromSlice(wsCon *WsConnection) {
+// Gets count of connected clients
+func (w *WsService) Count() int {
 	w.mutex.Lock()
-	if index := w.indexOf(wsCon); index >= 0 {
-		if len(w.cons) == 1 {
-			w.cons = w.cons[:0]
-		} else if index+1 == len(w.cons) {
-			w.cons = w.cons[:index]
-		} else {
-			w.cons = append(w.cons[:index], w.cons[index+1])
-		}
+	defer w.mutex.Unlock()
+	return len(w.cons)
+}
+
+// Answers message of client, unknown messages are ignored
+func (w *WsService) handleMessage(wsCon *WsConnection, data []byte) {
+	var msg wsClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if msg.Ping && !wsCon.send("{\"pong\": true}") {
+		wsCon.close()
 	}
+}
+
+func (w *WsService) remove(wsCon *WsConnection) {
+	w.mutex.Lock()
+	delete(w.cons, wsCon)
 	w.mutex.Unlock()
+	wsCon.close()
+}
+
+// Queues message, false is returned if queue is full
+func (w *WsConnection) send(msg string) bool {
+	select {
+	case w.msg <- msg:
+		return true
+	default:
+		return false
+	}
 }
 
-func (w *WsService) indexOf(wsCon *WsConnection) int {
-	for i, con := range w.cons {
-		if wsCon.Equals(con) {
-			return i
+// Stops serving of connection
+func (w *WsConnection) close() {
+	w.once.Do(func() {
+		close(w.closed)
+	})
+}
+
+// Reads messages of client until connection is closed or nothing, not even pong, is received within timeout
+func readWebSocket(con *websocket.Conn, timeout time.Duration, handle func(data []byte)) {
+	for {
+		con.SetReadDeadline(time.Now().Add(timeout))
+		frame, err := con.NewFrameReader()
+		if err != nil {
+			return
+		}
+		// Control frames are handled and nil is returned for them
+		if frame, err = con.HandleFrame(frame); err != nil {
+			return
+		} else if frame == nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(frame, wsMaxMessageSize+1))
+		if err != nil || len(data) > wsMaxMessageSize {
+			return
 		}
+		handle(data)
 	}
-	return -1
 }
 
-func (w *WsConnection) Equals(other *WsConnection) bool {
-	return w.id == other.id
+// Sends ping frame, that client answers by pong. Codec holds write lock of connection, so ping could not interleave
+// with pong written by reader.
+func pingWebSocket(con *websocket.Conn) error {
+	con.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return wsPing.Send(con, nil)
 }
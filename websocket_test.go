@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Waits until count of connected clients is reached
+func waitForWsClients(t *testing.T, w *WsService, count int) {
+	for i := 0; w.Count() != count; i++ {
+		if i > 200 {
+			t.Fatalf("waitForWsClients: expected %d clients, got %d", count, w.Count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketBroadcast(t *testing.T) {
+	c := NewContext(LoadConfig([]string{}))
+	w := NewWebSocketService(c)
+	srv := httptest.NewServer(websocket.Server{Handler: w.HandleWebSocket})
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http", "ws", 1)
+
+	const clients, messages = 50, 20
+	cons := make([]*websocket.Conn, clients)
+	for i := range cons {
+		con, err := websocket.Dial(url, "", srv.URL)
+		if err != nil {
+			panic(err)
+		}
+		defer con.Close()
+		cons[i] = con
+	}
+	waitForWsClients(t, w, clients)
+
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, clients)
+	for _, con := range cons {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				var msg string
+				if err := websocket.Message.Receive(con, &msg); err != nil {
+					errs <- err
+					return
+				} else if msg != fmt.Sprintf("{\"update\": \"%d\"}", i) {
+					errs <- fmt.Errorf("unexpected message '%s'", msg)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < messages; i++ {
+		w.Broadcast(fmt.Sprintf("{\"update\": \"%d\"}", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("TestWebSocketBroadcast: %s", err)
+	}
+
+	if err := websocket.Message.Send(cons[0], "{\"ping\": true}"); err != nil {
+		panic(err)
+	}
+	var msg string
+	if err := websocket.Message.Receive(cons[0], &msg); err != nil || msg != "{\"pong\": true}" {
+		t.Fatalf("TestWebSocketBroadcast: unexpected answer to ping '%s'", msg)
+	}
+
+	for _, con := range cons[clients/2:] {
+		con.Close()
+	}
+	waitForWsClients(t, w, clients/2)
+}
+
+func TestWebSocketSlowClient(t *testing.T) {
+	c := NewContext(LoadConfig([]string{}))
+	w := NewWebSocketService(c)
+
+	slow := &WsConnection{msg: make(chan string, wsQueueSize), closed: make(chan bool), once: &sync.Once{}}
+	w.cons[slow] = true
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i <= wsQueueSize; i++ {
+			c.broadcastProjects()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("TestWebSocketSlowClient: broadcast should not block")
+	}
+
+	select {
+	case <-slow.closed:
+	default:
+		t.Fatalf("TestWebSocketSlowClient: slow client should be disconnected")
+	}
+	if w.Count() != 0 {
+		t.Fatalf("TestWebSocketSlowClient: slow client should be removed")
+	}
+}
+
+func TestWebSocketKeepAlive(t *testing.T) {
+	c := NewContext(LoadConfig([]string{}))
+	w := NewWebSocketService(c)
+	w.pingInterval = 50 * time.Millisecond
+	srv := httptest.NewServer(websocket.Server{Handler: w.HandleWebSocket})
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http", "ws", 1)
+
+	// Client answers pings only while it reads
+	alive, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		panic(err)
+	}
+	defer alive.Close()
+	go func() {
+		var msg string
+		for websocket.Message.Receive(alive, &msg) == nil {
+		}
+	}()
+	stalled, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		panic(err)
+	}
+	defer stalled.Close()
+	waitForWsClients(t, w, 2)
+
+	time.Sleep(5 * w.pingInterval)
+	waitForWsClients(t, w, 1)
+
+	w.Broadcast("{\"projects\": true}")
+	time.Sleep(w.pingInterval)
+	if w.Count() != 1 {
+		t.Fatalf("TestWebSocketKeepAlive: responding client should stay connected")
+	}
+}
+
+func TestWebSocketConcurrentPings(t *testing.T) {
+	c := NewContext(LoadConfig([]string{}))
+	w := NewWebSocketService(c)
+	w.pingInterval = 5 * time.Millisecond
+	srv := httptest.NewServer(websocket.Server{Handler: w.HandleWebSocket})
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http", "ws", 1)
+
+	con, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		panic(err)
+	}
+	defer con.Close()
+	waitForWsClients(t, w, 1)
+
+	// Pongs written by server reader must not break pings written by server writer
+	go func() {
+		for wsPing.Send(con, nil) == nil {
+		}
+	}()
+	received := make(chan string)
+	go func() {
+		var msg string
+		for websocket.Message.Receive(con, &msg) == nil {
+			received <- msg
+		}
+		close(received)
+	}()
+	for i := 0; i < 20; i++ {
+		time.Sleep(w.pingInterval)
+		w.Broadcast(fmt.Sprintf("{\"update\": \"%d\"}", i))
+		if msg, ok := <-received; !ok || msg != fmt.Sprintf("{\"update\": \"%d\"}", i) {
+			t.Fatalf("TestWebSocketConcurrentPings: unexpected message '%s'", msg)
+		}
+	}
+}
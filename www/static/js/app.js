@@ -2,6 +2,8 @@ function initApp(name) {
 	var app = ajsf(name, (context, rootEl) => {
 		context.projectName = name;
 		context.history = [];
+		context.searchText = '';
+		context.expandedStages = {};
 		context.loading = 0;
 
 		var loadingOverlay = $(rootEl).find('.loading-overlay');
@@ -40,11 +42,13 @@ function initApp(name) {
 
 		context.loadHistory = (suppressOpen, suppressReload) => {
 			context.addLoading();
-			$.get(appUrl + "/projects/" + context.projectName, {
+			$.get(appUrl + "/projects/" + encodeURIComponent(context.projectName), {
 				success: data => {
 					var detail = JSON.parse(data);
 					var shouldRefresh = (detail.jobs.length != context.history.length || (detail.jobs.length > 0 && context.history.length > 0 && detail.jobs[0].status != context.history[0].status));
+					shouldRefresh = shouldRefresh || JSON.stringify(detail.disabled) != JSON.stringify(context.disabled);
 					context.history = detail.jobs;
+					context.disabled = detail.disabled;
 					if (context.history.length > 0) {
 						if (context.selectedJob == undefined) {
 							var rootEl = $(context.rootElement);
@@ -67,6 +71,13 @@ function initApp(name) {
 					if (shouldRefresh) {
 						context.refresh();
 					}
+					if (shouldRefresh && context.searchText != '') {
+						context.search(context.searchText);
+					}
+					if (shouldRefresh && context.stats != undefined) {
+						context.loadStats();
+					}
+					updateGroupStatus(context.projectName);
 				},
 				error: () => {
 					context.showMessage('error', 'Could not load ' + context.projectName);
@@ -80,6 +91,8 @@ function initApp(name) {
 		context.actionTitle = () => {
 			if (context.status == "inprogress") {
 				return "Interrupt";
+			} else if (context.disabled != undefined) {
+				return "Disabled";
 			}
 			return "Start";
 		};
@@ -87,10 +100,24 @@ function initApp(name) {
 		context.actionClass = () => {
 			if (context.status == "inprogress") {
 				return "action action-interrupt";
+			} else if (context.disabled != undefined) {
+				return "action action-disabled";
 			}
 			return "action action-start";
 		};
 
+		context.disabledValue = () => {
+			if (context.disabled == undefined) {
+				return "";
+			}
+			var result = "Disabled";
+			if (context.disabled.reason != undefined) {
+				result += ": " + context.disabled.reason;
+			}
+			var initiator = [context.disabled.user, context.startDateValue({startDate: context.disabled.date})].filter(v => v != undefined && v != '');
+			return result + ' (' + initiator.join(', ') + ')';
+		};
+
 		context.statusValue = (job) => {
 			if (job == undefined) {
 				job = context.selectedJob;
@@ -154,31 +181,25 @@ function initApp(name) {
 				event.stopPropagation();
 			}
 
+			if (context.status != 'inprogress' && context.disabled != undefined) {
+				context.showMessage('warn', context.projectName + ' is disabled');
+				return;
+			}
+
 			var params = {};
-			var action = appUrl + "/jobs/" + context.projectName + "/";
+			var action = appUrl + "/jobs/" + encodeURIComponent(context.projectName) + "/";
 			var actionName = "start";
 			if (context.status == 'inprogress') {
 				action += "interrupt/" + context.history[0].name
 				actionName = "interrupt";
 			} else {
 				action += "start"
-
-				var configEl = $(context.rootElement).find('.project-config');
-				if (!configEl.hasClass('collapsed')) {
-					configEl.find('.param-line').each((i, el) => {
-						var key = $(el).find('[name="key"]').val()
-						var val = $(el).find('[name="value"]').val()
-
-						if (key != '') {
-							params[key] = val;
-						}
-					});
-				}
+				params = context.configParams();
 			}
 
 			context.addLoading();
 			$.post(action, {
-				data: {'params': params},
+				data: {'params': params, 'cause': {'trigger': 'ui'}},
 				success: data => {
 					var msg = context.projectName + ' ' + actionName + 'ed';
 					if (actionName == 'start' && Object.keys(params).length > 0) {
@@ -196,6 +217,66 @@ function initApp(name) {
 			});
 		};
 
+		context.configParams = () => {
+			var params = {};
+			var configEl = $(context.rootElement).find('.project-config');
+			if (!configEl.hasClass('collapsed')) {
+				configEl.find('.param-line').each((i, el) => {
+					var key = $(el).find('[name="key"]').val()
+					var val = $(el).find('[name="value"]').val()
+
+					if (key != '') {
+						params[key] = val;
+					}
+				});
+			}
+			return params;
+		};
+
+		context.canRerun = () => {
+			return context.selectedJob != undefined && context.selectedJob.name != undefined && context.selectedJob.status != 'inprogress' && context.status != 'inprogress' && context.disabled == undefined;
+		};
+
+		context.rerunJob = (event) => {
+			if (event != undefined) {
+				event.preventDefault();
+				event.stopPropagation();
+			}
+
+			var params = context.configParams();
+			context.addLoading();
+			$.post(appUrl + "/jobs/" + encodeURIComponent(context.projectName) + "/rerun/" + context.selectedJob.name, {
+				data: {'params': params, 'cause': {'trigger': 'ui'}},
+				success: data => {
+					var msg = context.projectName + ' #' + context.selectedJob.name + ' rerun';
+					if (Object.keys(params).length > 0) {
+						msg += ' with parameters'
+					}
+					context.showMessage('info', msg);
+					setTimeout(() => {context.loadHistory(undefined, true);}, 100);
+				},
+				error: () => {
+					context.showMessage('error', 'Could not rerun ' + context.projectName);
+				},
+				complete: () => {
+					context.addLoading(-1);
+				}
+			});
+		};
+
+		context.rerunOf = () => {
+			if (context.selectedJob != undefined && context.selectedJob.cause != undefined && context.selectedJob.cause.rerunOf != undefined) {
+				return context.selectedJob.cause.rerunOf;
+			}
+			return "";
+		};
+
+		context.showRerunSource = (event) => {
+			if (context.rerunOf() != "") {
+				context.showJob(event, context.rerunOf());
+			}
+		};
+
 		context.setOutputCollapsed = (value) => {
 			const className = 'collapsed';
 			var title = $(context.rootElement).find('.job-title');
@@ -254,7 +335,7 @@ function initApp(name) {
 			if (hideLoading == undefined || !hideLoading) {
 				context.addLoading();
 			}
-			$.get(appUrl + "/jobs/" + context.projectName + "/" + jobNo, {
+			$.get(appUrl + "/jobs/" + encodeURIComponent(context.projectName) + "/" + jobNo, {
 				success: data => {
 					var job = JSON.parse(data);
 					if (job.status == "inprogress" && suppressReload == undefined) {
@@ -271,7 +352,8 @@ function initApp(name) {
 					var rootEl = $(context.rootElement);
 					rootEl.attr('class', 'project job-status-' + job.status + (rootEl.hasClass('maximized') ? ' maximized' : ''));
 					context.refresh();
-					rootEl.find('pre')[0].scrollTop = rootEl.find('pre')[0].scrollHeight;
+					var outputEl = context.hasStages() ? rootEl.find('.job-stages')[0] : rootEl.find('pre')[0];
+					outputEl.scrollTop = outputEl.scrollHeight;
 				},
 				error: () => {
 					context.showMessage('error', 'Could not load job #' + jobNo + ' from ' + context.projectName);
@@ -285,6 +367,69 @@ function initApp(name) {
 
 		};
 
+		context.paramsValue = (job) => {
+			if (job == undefined || job.params == undefined) {
+				return "";
+			}
+			return Object.keys(job.params).sort().map(key => key + '=' + job.params[key]).join(' ');
+		};
+
+		context.showParentJob = (event) => {
+			if (context.selectedJob != undefined && context.selectedJob.parent != undefined) {
+				context.showJob(event, context.selectedJob.parent);
+			}
+		};
+
+		context.hasStages = () => {
+			return context.selectedJob != undefined && context.selectedJob.stages != undefined && context.selectedJob.stages.length > 0;
+		};
+
+		context.stageSections = () => {
+			if (!context.hasStages()) {
+				return [];
+			}
+			var job = context.selectedJob;
+			var lines = (job.output != undefined ? job.output : '').split('\n');
+			var result = [];
+			if (job.stages[0].line > 0) {
+				result.push({name: 'Preparation', status: 'finished', output: lines.slice(0, job.stages[0].line).join('\n')});
+			}
+			job.stages.forEach((stage, i) => {
+				var end = i + 1 < job.stages.length ? job.stages[i + 1].line : lines.length;
+				result.push({name: stage.name, status: stage.status, startDate: stage.startDate, endDate: stage.endDate, output: lines.slice(stage.line, end).join('\n'), grouped: stage.group != undefined ? ' grouped' : '', progress: stage.status == 'inprogress' && stage.progress ? stage.progress + '%' : ''});
+			});
+			result.forEach((section, i) => {
+				section.key = job.name + '/' + i;
+				var expanded = context.expandedStages[section.key];
+				if (expanded == undefined) {
+					expanded = section.status == 'failed' || section.status == 'inprogress';
+				}
+				section.expanded = expanded ? ' expanded' : '';
+			});
+			return result;
+		};
+
+		context.toggleStage = (event, key) => {
+			if (event != undefined) {
+				event.preventDefault();
+				event.stopPropagation();
+			}
+
+			var section = context.stageSections().find(s => s.key == key);
+			if (section != undefined) {
+				context.expandedStages[key] = section.expanded == '';
+				context.refresh();
+			}
+		};
+
+		context.failedStage = () => {
+			if (!context.hasStages()) {
+				return "";
+			}
+			var stage = context.selectedJob.stages.find(s => s.status == 'failed');
+			return stage != undefined ? stage.name : "";
+		};
+
 		context.isSelected = (name) => {
 			if (context.selectedJob != undefined && context.selectedJob.name == name) {
 				return " selected";
@@ -292,13 +437,83 @@ function initApp(name) {
 			return "";
 		};
 
-		context.artifactDownloadUrl = () => {
+		context.isMatching = (name) => {
+			if (context.searchResult != undefined && !context.searchResult.includes(name)) {
+				return " unmatched";
+			}
+			return "";
+		};
+
+		context.search = (text) => {
+			context.searchText = text.trim();
+			if (context.searchText == '') {
+				context.searchResult = undefined;
+				context.refresh();
+				return;
+			}
+			$.get(appUrl + "/projects/" + encodeURIComponent(context.projectName) + "?q=" + encodeURIComponent(context.searchText), {
+				success: data => {
+					context.searchResult = JSON.parse(data).jobs.map(job => job.name);
+					context.refresh();
+				},
+				error: () => {
+					context.showMessage('error', 'Could not search ' + context.projectName);
+				}
+			});
+		};
+
+		context.artifactDownloadUrl = (name) => {
 			if (context.selectedJob != undefined && context.selectedJob.name != undefined) {
-				return appUrl.replace('rest', '') + "download/" + context.projectName + "/" + context.selectedJob.name;
+				var url = appUrl.replace('rest', '') + "download/" + encodeURIComponent(context.projectName) + "/" + context.selectedJob.name;
+				return typeof name == 'string' ? url + "/" + encodeURIComponent(name) : url;
 			}
 			else "";
 		};
 
+		context.causeValue = () => {
+			if (context.selectedJob == undefined || context.selectedJob.cause == undefined) {
+				return "";
+			}
+			var cause = context.selectedJob.cause;
+			var result = {ui: 'UI', rest: 'REST API', cli: 'CLI', script: 'job'}[cause.trigger] || cause.trigger;
+			if (cause.project != undefined) {
+				result += ' #' + cause.job + ' of ' + cause.project;
+			}
+			var initiator = [cause.user, cause.remote].filter(v => v != undefined && v != '');
+			if (initiator.length > 0) {
+				result += ' (' + initiator.join(', ') + ')';
+			}
+			return result;
+		};
+
+		context.hasMeta = () => {
+			return context.selectedJob != undefined && (context.selectedJob.meta != undefined || context.namedArtifacts().length > 0);
+		};
+
+		context.metaValue = (key) => {
+			if (context.selectedJob != undefined && context.selectedJob.meta != undefined && context.selectedJob.meta[key] != undefined) {
+				return context.selectedJob.meta[key];
+			}
+			return "";
+		};
+
+		context.badges = () => {
+			var badges = context.metaValue('badges');
+			return badges != "" ? badges : [];
+		};
+
+		context.labels = () => {
+			var labels = context.metaValue('labels');
+			return labels != "" ? Object.keys(labels).map(key => key + ': ' + labels[key]) : [];
+		};
+
+		context.namedArtifacts = () => {
+			if (context.selectedJob != undefined && context.selectedJob.artifacts != undefined) {
+				return context.selectedJob.artifacts;
+			}
+			return [];
+		};
+
 		context.artifactExists = () => {
 			return context.selectedJob != undefined && context.selectedJob.artifactSize != undefined && context.selectedJob.artifactSize > 0;
 		};
@@ -337,6 +552,60 @@ function initApp(name) {
 			}
 		};
 
+		context.toggleStats = (event) => {
+			if (event != undefined) {
+				event.preventDefault();
+				event.stopPropagation();
+			}
+
+			if (context.stats != undefined) {
+				context.stats = undefined;
+				context.refresh();
+			} else {
+				context.loadStats();
+			}
+		};
+
+		context.loadStats = () => {
+			$.get(appUrl + "/stats/" + encodeURIComponent(context.projectName), {
+				success: data => {
+					context.stats = JSON.parse(data);
+					context.refresh();
+				},
+				error: () => {
+					context.showMessage('error', 'Could not load statistics of ' + context.projectName);
+				}
+			});
+		};
+
+		context.formatSeconds = (seconds) => {
+			return (Math.round(seconds * 10) / 10) + "s";
+		};
+
+		context.statsSummary = () => {
+			if (context.stats == undefined) {
+				return [];
+			}
+			var stats = context.stats;
+			return [
+				'Jobs: ' + stats.jobs,
+				'Success rate: ' + Math.round(stats.successRate * 100) + '%',
+				'Mean duration: ' + context.formatSeconds(stats.meanDuration),
+				'P95 duration: ' + context.formatSeconds(stats.p95Duration),
+				'Failure streak: ' + stats.failureStreak + ' (longest ' + stats.longestFailureStreak + ')',
+				'MTTR: ' + (stats.recoveries > 0 ? context.formatSeconds(stats.mttr) : '-')
+			];
+		};
+
+		context.recordDuration = (record) => {
+			return Math.max(new Date(record.endDate) - new Date(record.startDate), 0) / 1000;
+		};
+
+		context.trendStyle = (record) => {
+			var longest = Math.max(...context.stats.trend.map(context.recordDuration), 1);
+			return 'height: ' + Math.max(5, Math.round(context.recordDuration(record) / longest * 100)) + '%;';
+		};
+
 		context.fixConfigHeight = (configEl) => {
 			var totalHeight = 0;
 			configEl.find(".project-config > *").each(function(i, el){
@@ -405,6 +674,12 @@ function initApp(name) {
 			$(context.rootElement).find('.project-config .param-line').remove();
 		};
 
+		var searchTimeout;
+		$(rootEl).find('.history-search input').on('keyup', (event) => {
+			clearTimeout(searchTimeout);
+			searchTimeout = setTimeout(() => context.search(event.target.value), 300);
+		});
+
 		context.loadHistory();
 
 		return context;
@@ -422,6 +697,10 @@ function initApp(name) {
 		$(el).attr('href', value);
 	});
 
+	app.attribute('ajsf-style', (el, value) => {
+		$(el).attr('style', value);
+	});
+
 	return app;
 }
 
@@ -434,11 +713,87 @@ $('[ajsf]').each((i, el) => {
 	}
 });
 
+const groupsItemName = "lurch.groups.collapsed";
+
+function groupOf(projectName) {
+	return projectName.substring(0, Math.max(projectName.lastIndexOf('/'), 0));
+}
+
+function updateGroupStatus(projectName) {
+	var groupName = groupOf(projectName);
+	if (groupName == '') {
+		return;
+	}
+	var statuses = [];
+	appMap.forEach((app, name) => {
+		if (groupOf(name) == groupName && app.context.status != undefined) {
+			statuses.push(app.context.status);
+		}
+	});
+	var status = ['inprogress', 'failed', 'stopped', 'finished'].find(s => statuses.includes(s)) || 'empty';
+	$('.group-header').each((i, el) => {
+		if ($(el).attr('lurch-group') == groupName) {
+			$(el).attr('class', 'group-header job-status-' + status);
+		}
+	});
+}
+
+function initGroups() {
+	var collapsed = JSON.parse(localStorage.getItem(groupsItemName) || '[]');
+	$('.group-header').each((i, el) => {
+		var header = $(el);
+		var group = header.parent();
+		if (collapsed.includes(header.attr('lurch-group'))) {
+			group.addClass('collapsed');
+		}
+		header.click(() => {
+			var collapsed = JSON.parse(localStorage.getItem(groupsItemName) || '[]').filter(name => name != header.attr('lurch-group'));
+			if (group.hasClass('collapsed')) {
+				group.removeClass('collapsed');
+			} else {
+				group.addClass('collapsed');
+				collapsed.push(header.attr('lurch-group'));
+			}
+			localStorage.setItem(groupsItemName, JSON.stringify(collapsed));
+		});
+	});
+}
+
+initGroups();
+
+let wsConnected = false;
+
 function connectToWs() {
 	wsUrl = (window.location.protocol == 'https:' ? 'wss://' : 'ws://') + window.location.host + window.location.pathname + 'ws/';
 	const socket = new WebSocket(wsUrl);
+	let heartbeat;
+	let pongReceived = true;
+	socket.addEventListener("open", () => {
+		// Updates could be missed while disconnected
+		if (wsConnected) {
+			appMap.forEach(app => app.context.loadHistory(true));
+		}
+		wsConnected = true;
+		heartbeat = setInterval(() => {
+			if (!pongReceived) {
+				socket.close();
+				return;
+			}
+			pongReceived = false;
+			socket.send('{"ping": true}');
+		}, 30000);
+	});
 	socket.addEventListener("message", (event) => {
 		let msg = JSON.parse(event.data);
+		if (msg["pong"]) {
+			pongReceived = true;
+		}
+		if (msg["draining"]) {
+			$('#notice')[0].style.display = 'block';
+		}
+		if (msg["projects"]) {
+			window.location.reload();
+		}
 		let updateApp = msg["update"];
 		if (updateApp !== undefined) {
 			let app = appMap.get(updateApp);
@@ -446,6 +801,7 @@ function connectToWs() {
 		}
 	});
 	socket.addEventListener("close", () => {
+		clearInterval(heartbeat);
 		setTimeout(connectToWs, 1000);
 	});
 }
@@ -0,0 +1,119 @@
+ajsf("lurch-editor", (context, rootEl) => {
+	const tokenItemName = "lurch.token";
+	const themeItemName = "lurch.theme";
+
+	context.token = localStorage.getItem(tokenItemName) || '';
+	context.script = '';
+	context.pipeline = '';
+	context.params = '';
+
+	if (localStorage.getItem(themeItemName) == "dark") {
+		$('body').attr("id", "dark");
+	}
+
+	context.showMessage = (type, message) => {
+		var messageDiv = $("<div></div>")
+			.attr('class', 'message ' + type)
+			.appendTo($("#messageBox"));
+		messageDiv[0].textContent = message;
+
+		messageDiv.click(() => {
+			messageDiv.remove();
+		});
+
+		setTimeout(() => {
+			messageDiv.remove();
+		}, 3000);
+	};
+
+	context.headers = () => {
+		localStorage.setItem(tokenItemName, context.token);
+		return {'Authorization': 'Bearer ' + context.token};
+	};
+
+	context.errorMessage = (xhr, message) => {
+		try {
+			return message + ': ' + JSON.parse(xhr.responseText).message;
+		} catch (e) {
+			return message;
+		}
+	};
+
+	context.projectUrl = () => {
+		return apiUrl + "/projects/" + encodeURIComponent(projectName);
+	};
+
+	context.load = (event) => {
+		if (event != undefined) {
+			event.preventDefault();
+			event.stopPropagation();
+		}
+
+		$.get(context.projectUrl() + "/script", {
+			headers: context.headers(),
+			success: data => {
+				context.script = data;
+				context.refresh();
+			},
+			error: xhr => {
+				context.showMessage('error', context.errorMessage(xhr, 'Could not load script of ' + projectName));
+			}
+		});
+		$.get(context.projectUrl() + "/settings", {
+			headers: context.headers(),
+			success: data => {
+				var settings = JSON.parse(data);
+				context.pipeline = settings.pipeline;
+				context.params = Object.keys(settings.params || {}).sort().map(key => key + '=' + settings.params[key]).join('\n');
+				context.refresh();
+			},
+			error: xhr => {
+				context.showMessage('error', context.errorMessage(xhr, 'Could not load settings of ' + projectName));
+			}
+		});
+	};
+
+	context.parseParams = () => {
+		var params = {};
+		context.params.split('\n').forEach(line => {
+			var i = line.indexOf('=');
+			if (i > 0) {
+				params[line.substring(0, i).trim()] = line.substring(i + 1);
+			}
+		});
+		return params;
+	};
+
+	context.save = (event) => {
+		if (event != undefined) {
+			event.preventDefault();
+			event.stopPropagation();
+		}
+
+		$.put(context.projectUrl() + "/settings", {
+			headers: context.headers(),
+			data: {'params': context.parseParams(), 'pipeline': context.pipeline},
+			success: () => {
+				$.put(context.projectUrl() + "/script", {
+					headers: context.headers(),
+					data: context.script,
+					success: () => {
+						context.showMessage('info', projectName + ' saved');
+					},
+					error: xhr => {
+						context.showMessage('error', context.errorMessage(xhr, 'Could not save script of ' + projectName));
+					}
+				});
+			},
+			error: xhr => {
+				context.showMessage('error', context.errorMessage(xhr, 'Could not save settings of ' + projectName));
+			}
+		});
+	};
+
+	if (context.token != '') {
+		context.load();
+	}
+
+	return context;
+});
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parser of simple subset of YAML, that is sufficient for project definitions. It supports block mappings and
+// sequences, plain and quoted scalars, literal and folded block scalars and simple flow sequences and mappings.
+// Mappings are parsed into map[string]any, sequences into []any and all scalars are kept as strings. Supported
+// subset is described in readme.md.
+type yamlParser struct {
+	lines []string
+	i     int
+}
+
+// Parses YAML document
+func parseYaml(data string) (any, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")}
+	for i, line := range p.lines {
+		if strings.HasPrefix(line, "\t") && strings.TrimSpace(line) != "" {
+			return nil, fmt.Errorf("line %d: tabs could not be used for indentation", i+1)
+		}
+	}
+	p.skipEmpty()
+	if p.i >= len(p.lines) {
+		return nil, nil
+	}
+	result, err := p.parseNode(p.indent())
+	if err != nil {
+		return nil, err
+	}
+	p.skipEmpty()
+	if p.i < len(p.lines) {
+		return nil, p.errorf("unexpected content")
+	}
+	return result, nil
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.i+1, fmt.Sprintf(format, args...))
+}
+
+// Moves to next line with content
+func (p *yamlParser) skipEmpty() {
+	for p.i < len(p.lines) {
+		line := strings.TrimSpace(p.lines[p.i])
+		if line != "" && !strings.HasPrefix(line, "#") && line != "---" {
+			return
+		}
+		p.i++
+	}
+}
+
+func (p *yamlParser) indent() int {
+	return len(p.lines[p.i]) - len(strings.TrimLeft(p.lines[p.i], " "))
+}
+
+func (p *yamlParser) content() string {
+	return stripYamlComment(strings.TrimSpace(p.lines[p.i]))
+}
+
+func (p *yamlParser) parseNode(indent int) (any, error) {
+	if isYamlSequenceItem(p.content()) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	result := make([]any, 0)
+	for p.skipEmpty(); p.i < len(p.lines) && p.indent() == indent && isYamlSequenceItem(p.content()); p.skipEmpty() {
+		item := strings.TrimSpace(strings.TrimPrefix(p.content(), "-"))
+		if item == "" {
+			p.i++
+			p.skipEmpty()
+			if p.i >= len(p.lines) || p.indent() <= indent {
+				result = append(result, "")
+				continue
+			}
+			value, err := p.parseNode(p.indent())
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		} else if _, _, ok := splitYamlKey(item); ok {
+			// Mapping starting on the same line as item is parsed as it was indented on its own line
+			itemIndent := indent + len(p.content()) - len(strings.TrimLeft(strings.TrimPrefix(p.content(), "-"), " "))
+			p.lines[p.i] = strings.Repeat(" ", itemIndent) + item
+			value, err := p.parseMapping(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		} else {
+			value, err := p.parseScalar(item, indent)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+	}
+	if p.i < len(p.lines) && p.indent() > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return result, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	result := make(map[string]any)
+	for p.skipEmpty(); p.i < len(p.lines) && p.indent() == indent; p.skipEmpty() {
+		if isYamlSequenceItem(p.content()) {
+			return nil, p.errorf("unexpected sequence item")
+		}
+		key, value, ok := splitYamlKey(p.content())
+		if !ok {
+			return nil, p.errorf("expected key and value")
+		}
+		if _, exists := result[key]; exists {
+			return nil, p.errorf("duplicate key '%s'", key)
+		}
+		if value == "" {
+			p.i++
+			p.skipEmpty()
+			if p.i < len(p.lines) && (p.indent() > indent || (p.indent() == indent && isYamlSequenceItem(p.content()))) {
+				node, err := p.parseNode(p.indent())
+				if err != nil {
+					return nil, err
+				}
+				result[key] = node
+			} else {
+				result[key] = ""
+			}
+			continue
+		}
+		node, err := p.parseScalar(value, indent)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = node
+	}
+	if p.i < len(p.lines) && p.indent() > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return result, nil
+}
+
+// Parses scalar value on current line and moves to next line, block scalar consumes all more indented lines
+func (p *yamlParser) parseScalar(value string, indent int) (any, error) {
+	p.i++
+	switch {
+	case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+		return p.parseBlockScalar(value, indent), nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", p.i)
+		}
+		result := make([]any, 0)
+		for _, item := range splitYamlFlow(value[1 : len(value)-1]) {
+			result = append(result, unquoteYaml(item))
+		}
+		return result, nil
+	case strings.HasPrefix(value, "{"):
+		if !strings.HasSuffix(value, "}") {
+			return nil, fmt.Errorf("line %d: unterminated flow mapping", p.i)
+		}
+		result := make(map[string]any)
+		for _, item := range splitYamlFlow(value[1 : len(value)-1]) {
+			k, v, ok := splitYamlKey(item)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key and value in flow mapping", p.i)
+			}
+			result[k] = unquoteYaml(v)
+		}
+		return result, nil
+	}
+	return unquoteYaml(value), nil
+}
+
+func (p *yamlParser) parseBlockScalar(header string, indent int) string {
+	folded := strings.HasPrefix(header, ">")
+	lines := make([]string, 0)
+	blockIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		line := p.lines[p.i]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	separator := "\n"
+	if folded {
+		separator = " "
+	}
+	result := strings.Join(lines, separator)
+	if !strings.HasSuffix(header, "-") {
+		result += "\n"
+	}
+	return result
+}
+
+func isYamlSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// Splits line into key and value, value might be empty
+func splitYamlKey(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+		end := strings.Index(content[1:], content[:1])
+		if end < 0 {
+			return "", "", false
+		}
+		rest := content[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return unquoteYaml(content[:end+2]), strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasSuffix(content, ":") {
+		return strings.TrimSpace(content[:len(content)-1]), "", true
+	}
+	if i := strings.Index(content, ": "); i > 0 {
+		return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+2:]), true
+	}
+	return "", "", false
+}
+
+// Splits content of flow collection by commas outside of quotes
+func splitYamlFlow(content string) []string {
+	result := make([]string, 0)
+	var quote rune
+	start := 0
+	for i, r := range content {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			result = append(result, strings.TrimSpace(content[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(content[start:]); last != "" {
+		result = append(result, last)
+	}
+	return result
+}
+
+func unquoteYaml(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value[1 : len(value)-1]
+	}
+	if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
+
+// Removes comment from the end of line, if it is not part of quoted value
+func stripYamlComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote == '\'' && r == '\'' && strings.HasPrefix(line[i+1:], "'"):
+			// Doubled quote is escaped quote, it is skipped as escaped character
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '[' || line[i-1] == '{' || line[i-1] == ',' || line[i-1] == '-' {
+				quote = r
+			}
+		case r == '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return strings.TrimSpace(line[:i])
+			}
+		}
+	}
+	return line
+}
+
+func yamlString(value any, name string) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("'%s' should be a value", name)
+}
+
+func yamlBool(value any, name string) (bool, error) {
+	s, err := yamlString(value, name)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' should be true or false", name)
+}
+
+func yamlList(value any, name string) ([]any, error) {
+	if l, ok := value.([]any); ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("'%s' should be a list", name)
+}
+
+func yamlMap(value any, name string) (map[string]any, error) {
+	if m, ok := value.(map[string]any); ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("'%s' should be a mapping", name)
+}
+
+func yamlStringMap(value any, name string) (map[string]string, error) {
+	m, err := yamlMap(value, name)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for k, v := range m {
+		if result[k], err = yamlString(v, name+"."+k); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Parses duration either in format of time.ParseDuration or as number of seconds
+func yamlDuration(value any, name string) (time.Duration, error) {
+	s, err := yamlString(value, name)
+	if err != nil {
+		return 0, err
+	}
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' should be a duration", name)
+	}
+	return d, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYaml(t *testing.T) {
+	data := `# project definition
+env:
+  GOFLAGS: -mod=mod
+  QUOTED: "a # b"
+steps:
+  - name: build
+    run: make build # comment
+  - name: 'test it'
+    run: |
+      make test
+      make lint
+    continue-on-error: true
+  -
+    run: >-
+      echo
+      done
+tags: [linux, "amd 64"]
+empty:
+`
+	expected := map[string]any{
+		"env": map[string]any{"GOFLAGS": "-mod=mod", "QUOTED": "a # b"},
+		"steps": []any{
+			map[string]any{"name": "build", "run": "make build"},
+			map[string]any{"name": "test it", "run": "make test\nmake lint\n", "continue-on-error": "true"},
+			map[string]any{"run": "echo done"},
+		},
+		"tags":  []any{"linux", "amd 64"},
+		"empty": "",
+	}
+
+	result, err := parseYaml(data)
+	if err != nil {
+		t.Fatal("TestParseYaml: unexpected error", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("TestParseYaml: unexpected result %#v", result)
+	}
+}
+
+func TestParseYamlErrors(t *testing.T) {
+	for _, data := range []string{"key: value\n  nested: value", "- item\nkey: value", "key: value\nkey: other", "just text", "key: [a, b"} {
+		if _, err := parseYaml(data); err == nil {
+			t.Fatalf("TestParseYamlErrors: expected error for '%s'", data)
+		}
+	}
+}
+
+func TestParseYamlConstructs(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     string
+		expected any
+	}{
+		{"empty document", "# only comment\n\n", nil},
+		{"document marker", "---\nkey: value", map[string]any{"key": "value"}},
+		{"nested mapping", "a:\n  b:\n    c: d\n  e: f", map[string]any{"a": map[string]any{"b": map[string]any{"c": "d"}, "e": "f"}}},
+		{"empty value", "a:\nb: c", map[string]any{"a": "", "b": "c"}},
+		{"sequence of scalars", "- a\n- b", []any{"a", "b"}},
+		{"sequence at indent of key", "list:\n- a\n- b", map[string]any{"list": []any{"a", "b"}}},
+		{"empty item", "- \n- a", []any{"", "a"}},
+		{"nested sequence", "-\n  - a\n  - b", []any{[]any{"a", "b"}}},
+		{"mapping in item", "- a: b\n  c: d\n-\n  e: f", []any{map[string]any{"a": "b", "c": "d"}, map[string]any{"e": "f"}}},
+		{"plain scalar with colon", "url: http://localhost:5000/a", map[string]any{"url": "http://localhost:5000/a"}},
+		{"double quoted", `a: "tab\there \"q\""`, map[string]any{"a": "tab\there \"q\""}},
+		{"escaped quote before hash", `a: "x \" # y" # z`, map[string]any{"a": "x \" # y"}},
+		{"single quoted", "a: 'it''s # not comment'", map[string]any{"a": "it's # not comment"}},
+		{"quoted key", `"a: b": c` + "\n'd': e", map[string]any{"a: b": "c", "d": "e"}},
+		{"comments", "# head\na: b # tail\nc: d#e", map[string]any{"a": "b", "c": "d#e"}},
+		{"literal", "a: |\n  one\n\n    two\nb: c", map[string]any{"a": "one\n\n  two\n", "b": "c"}},
+		{"literal strip", "a: |-\n  one\n  two", map[string]any{"a": "one\ntwo"}},
+		{"folded", "a: >\n  one\n  two", map[string]any{"a": "one two\n"}},
+		{"folded strip", "- >-\n  one\n  two", []any{"one two"}},
+		{"flow sequence", `a: [x, "y, z", 'w']`, map[string]any{"a": []any{"x", "y, z", "w"}}},
+		{"empty flow sequence", "a: []", map[string]any{"a": []any{}}},
+		{"flow mapping", `a: {x: 1, "y": "2, 3", z: "4"}`, map[string]any{"a": map[string]any{"x": "1", "y": "2, 3", "z": "4"}}},
+		{"windows line endings", "a: b\r\nc: d\r\n", map[string]any{"a": "b", "c": "d"}},
+	} {
+		result, err := parseYaml(tc.data)
+		if err != nil {
+			t.Fatalf("TestParseYamlConstructs: unexpected error in %s: %s", tc.name, err)
+		}
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Fatalf("TestParseYamlConstructs: unexpected result of %s %#v", tc.name, result)
+		}
+	}
+
+	for _, data := range []string{"a:\n\tb: c", "a: {x}", "a: {x: 1", "'a: b", "- a\n  - b"} {
+		if _, err := parseYaml(data); err == nil {
+			t.Fatalf("TestParseYamlConstructs: expected error for '%s'", data)
+		}
+	}
+}